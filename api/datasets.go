@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	"github.com/ONSdigital/go-ns/handlers/response"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// ErrorResponse the body of an error response.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// DatasetsHandler returns a handler that lists the jobs of the splits in progress and of recently finished splits,
+// newest first.
+func DatasetsHandler(jobs *splitter.JobRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, jobs.List(), http.StatusOK)
+	}
+}
+
+// DatasetHandler returns a handler that reports the job of the dataset whose ID is the :id route parameter.
+func DatasetHandler(jobs *splitter.JobRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		job, ok := jobs.Get(req.URL.Query().Get(":id"))
+		if !ok {
+			writeJSON(w, ErrorResponse{Error: "dataset not found"}, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, job, http.StatusOK)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}, status int) {
+	if err := response.WriteJSON(w, value, status); err != nil {
+		log.Error(err, log.Data{"message": "Failed to write response"})
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	"github.com/gorilla/pat"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDatasetHandlers(t *testing.T) {
+	Convey("Given a job registry with two queued jobs", t, func() {
+		jobs := splitter.NewJobRegistry()
+		jobs.Queue("first", "s3://bucket/first.csv")
+		jobs.Queue("second", "s3://bucket/second.csv")
+
+		router := pat.New()
+		router.Get("/datasets/{id}", DatasetHandler(jobs))
+		router.Get("/datasets", DatasetsHandler(jobs))
+
+		get := func(path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			return w
+		}
+
+		Convey("When the datasets are listed", func() {
+			w := get("/datasets")
+
+			Convey("Then every job is returned, newest first", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				var body []splitter.Job
+				So(json.Unmarshal(w.Body.Bytes(), &body), ShouldBeNil)
+				So(body, ShouldHaveLength, 2)
+				So(body[0].DatasetID, ShouldEqual, "second")
+				So(body[1].DatasetID, ShouldEqual, "first")
+			})
+		})
+
+		Convey("When a dataset is requested", func() {
+			w := get("/datasets/first")
+
+			Convey("Then its job is returned", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				var body splitter.Job
+				So(json.Unmarshal(w.Body.Bytes(), &body), ShouldBeNil)
+				So(body.DatasetID, ShouldEqual, "first")
+				So(body.SourceURL, ShouldEqual, "s3://bucket/first.csv")
+				So(body.State, ShouldEqual, splitter.JobQueued)
+			})
+		})
+
+		Convey("When an unknown dataset is requested", func() {
+			w := get("/datasets/unknown")
+
+			Convey("Then a 404 is returned", func() {
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// Names of the Server-Sent Events streamed for a dataset.
+const (
+	EventProgress = "progress"
+	EventComplete = splitter.JobComplete
+	EventFailed   = splitter.JobFailed
+)
+
+// DatasetEventsHandler returns a handler that streams the progress of the split of the dataset whose ID is the :id
+// route parameter as Server-Sent Events. A progress event carrying the dataset's job is sent on connecting and as each
+// batch of rows is sent, followed by a single complete or failed event once the split has finished, when the stream
+// ends.
+func DatasetEventsHandler(jobs *splitter.JobRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		datasetID := req.URL.Query().Get(":id")
+		job, progress, unsubscribe, ok := jobs.Subscribe(datasetID)
+		if !ok {
+			writeJSON(w, ErrorResponse{Error: "dataset not found"}, http.StatusNotFound)
+			return
+		}
+		defer unsubscribe()
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeJSON(w, ErrorResponse{Error: "streaming is not supported"}, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		if !job.Finished() {
+			if err := writeEvent(w, EventProgress, job); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+
+		for {
+			select {
+			case update, open := <-progress:
+				if !open {
+					// The job has finished, so report its outcome as it was recorded.
+					if finished, ok := jobs.Get(datasetID); ok {
+						job = finished
+					}
+					writeEvent(w, job.State, job)
+					flusher.Flush()
+					return
+				}
+				job = update
+				if err := writeEvent(w, EventProgress, job); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-req.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, job splitter.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		log.ErrorC(job.DatasetID, err, log.Data{"message": "Failed to marshal dataset event"})
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	"github.com/gorilla/pat"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// readEvent returns the name and data of the next Server-Sent Event in the stream.
+func readEvent(stream *bufio.Reader) (string, string) {
+	var name, data string
+	for {
+		line, err := stream.ReadString('\n')
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case len(line) == 0 || err != nil:
+			return name, data
+		}
+	}
+}
+
+func TestDatasetEventsHandler(t *testing.T) {
+	Convey("Given a queued job and a server streaming its events", t, func() {
+		jobs := splitter.NewJobRegistry()
+		jobs.Queue("dataset", "s3://bucket/file.csv")
+
+		router := pat.New()
+		router.Get("/datasets/{id}/events", DatasetEventsHandler(jobs))
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		Convey("When the events are requested", func() {
+			response, err := http.Get(server.URL + "/datasets/dataset/events")
+			So(err, ShouldBeNil)
+			defer response.Body.Close()
+			stream := bufio.NewReader(response.Body)
+
+			Convey("Then the job's progress is streamed until it fails", func() {
+				So(response.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+
+				name, data := readEvent(stream)
+				So(name, ShouldEqual, EventProgress)
+				So(data, ShouldContainSubstring, `"state":"queued"`)
+
+				jobs.Fail("dataset", errors.New("file not found"))
+				name, data = readEvent(stream)
+				So(name, ShouldEqual, EventFailed)
+				So(data, ShouldContainSubstring, `"lastError":"file not found"`)
+
+				_, err := stream.ReadByte()
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the events of a finished job are requested", func() {
+			jobs.Fail("dataset", errors.New("file not found"))
+			response, err := http.Get(server.URL + "/datasets/dataset/events")
+			So(err, ShouldBeNil)
+			defer response.Body.Close()
+
+			Convey("Then only its outcome is sent", func() {
+				name, _ := readEvent(bufio.NewReader(response.Body))
+				So(name, ShouldEqual, EventFailed)
+			})
+		})
+
+		Convey("When the events of an unknown dataset are requested", func() {
+			response, err := http.Get(server.URL + "/datasets/unknown/events")
+			So(err, ShouldBeNil)
+			response.Body.Close()
+
+			Convey("Then a 404 is returned", func() {
+				So(response.StatusCode, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
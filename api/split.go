@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+	"github.com/ONSdigital/dp-csv-splitter/message"
+	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/source"
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// SplitRequest the body of a request to split a file.
+type SplitRequest struct {
+	// S3URL the URL of the file, whose scheme must be in config.SplitAPISchemes and whose bucket, or host, must be in
+	// config.SplitAPIBuckets.
+	S3URL string `json:"s3URL"`
+	// DatasetID the ID of the dataset to split the file into. When empty the ID is derived as it is for a FileUploaded
+	// event, so an interrupted split of the file is resumed.
+	DatasetID string `json:"datasetID,omitempty"`
+	// Topic the Kafka topic to send the row messages to, in place of the configured row topic when set. It must be in
+	// config.SplitAPITopics.
+	Topic string `json:"topic,omitempty"`
+	// BatchSize the number of rows to send to Kafka in a single batch, in place of the configured batch size when set.
+	// It must be no more than config.MaxBatchSize.
+	BatchSize int `json:"batchSize,omitempty"`
+	// ArchiveMember the name of the CSV file to split from a zip archive, which is required for an archive.
+	ArchiveMember string `json:"archiveMember,omitempty"`
+}
+
+// SplitResponse the body of the response to an accepted split request.
+type SplitResponse struct {
+	// JobID the ID of the dataset, which its job can be polled with at /datasets/{id}.
+	JobID string `json:"jobID"`
+}
+
+// SplitHandler returns a handler that splits a file without a FileUploaded event being sent to Kafka. The file is
+// split in the background as though the event had been consumed, but without retries, and the response gives the ID of
+// the job to poll for its progress in splitter.Jobs. At most config.SplitAPIConcurrency splits run at once.
+func SplitHandler(sources source.Source, csvProcessor splitter.CSVProcessor) http.HandlerFunc {
+	splits := make(chan struct{}, config.SplitAPIConcurrency)
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		var splitRequest SplitRequest
+		if err := json.NewDecoder(req.Body).Decode(&splitRequest); err != nil {
+			writeJSON(w, ErrorResponse{Error: "invalid request body: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+
+		s3URL, err := url.Parse(splitRequest.S3URL)
+		if err != nil {
+			writeJSON(w, ErrorResponse{Error: "invalid s3URL: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if err := checkSplitRequest(splitRequest, s3URL); err != nil {
+			writeJSON(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+			return
+		}
+
+		uploadEvent := &event.FileUploaded{
+			Time:          time.Now().UTC().Unix(),
+			S3URL:         event.NewS3URL(s3URL),
+			ArchiveMember: splitRequest.ArchiveMember,
+			DatasetID:     splitRequest.DatasetID,
+			Topic:         splitRequest.Topic,
+			BatchSize:     splitRequest.BatchSize,
+		}
+		if err := uploadEvent.Validate(); err != nil {
+			writeJSON(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case splits <- struct{}{}:
+		default:
+			writeJSON(w, ErrorResponse{Error: "too many splits in progress"}, http.StatusServiceUnavailable)
+			return
+		}
+
+		log.Debug("Split requested", log.Data{"url": uploadEvent.GetSourceURL()})
+		processor := &startingProcessor{CSVProcessor: csvProcessor, started: make(chan string, 1)}
+		done := make(chan error, 1)
+		go func() {
+			defer func() { <-splits }()
+			err := message.ProcessEvent(uploadEvent, sources, processor)
+			if err != nil {
+				log.Error(err, log.Data{"details": "Failed to split requested file", "url": uploadEvent.GetSourceURL()})
+			}
+			done <- err
+		}()
+
+		// The dataset ID is only known once the file has been opened, so the response waits for the split to start.
+		select {
+		case datasetID := <-processor.started:
+			writeJSON(w, SplitResponse{JobID: datasetID}, http.StatusAccepted)
+		case err := <-done:
+			// A split that started and then failed has already been reported, and its job records the error.
+			select {
+			case datasetID := <-processor.started:
+				writeJSON(w, SplitResponse{JobID: datasetID}, http.StatusAccepted)
+				return
+			default:
+			}
+			if err == splitter.ErrJobInProgress {
+				writeJSON(w, ErrorResponse{Error: err.Error()}, http.StatusConflict)
+				return
+			}
+			writeJSON(w, ErrorResponse{Error: "failed to start split: " + err.Error()}, http.StatusBadGateway)
+		}
+	}
+}
+
+// checkSplitRequest returns an error if the request is for a file, or to a topic, that the split API does not allow.
+func checkSplitRequest(splitRequest SplitRequest, s3URL *url.URL) error {
+	if !contains(config.SplitAPISchemes, s3URL.Scheme) {
+		return fmt.Errorf("s3URL scheme %q is not allowed", s3URL.Scheme)
+	}
+	if !contains(config.SplitAPIBuckets, s3URL.Host) {
+		return fmt.Errorf("s3URL bucket %q is not allowed", s3URL.Host)
+	}
+	if len(splitRequest.Topic) > 0 && splitRequest.Topic != config.RowTopicName && !contains(config.SplitAPITopics, splitRequest.Topic) {
+		return fmt.Errorf("topic %q is not allowed", splitRequest.Topic)
+	}
+	if len(splitRequest.ArchiveMember) == 0 && strings.EqualFold(path.Ext(s3URL.Path), ".zip") {
+		return errors.New("archiveMember is required to split a zip archive")
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// startingProcessor reports on started the ID of the dataset a requested file is split into, which is only known
+// once the file has been opened, before handing the split to the CSVProcessor.
+type startingProcessor struct {
+	splitter.CSVProcessor
+	started chan string
+}
+
+func (p *startingProcessor) Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string, version string) error {
+	p.started <- datasetID
+	return p.CSVProcessor.Process(r, event, startTime, datasetID, version)
+}
+
+func (p *startingProcessor) Resume(r io.Reader, event *event.FileUploaded, startTime time.Time, checkpoint *splitter.Checkpoint) error {
+	p.started <- checkpoint.DatasetID
+	return p.CSVProcessor.Resume(r, event, startTime, checkpoint)
+}
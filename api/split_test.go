@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/source"
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type split struct {
+	event     *event.FileUploaded
+	datasetID string
+}
+
+type mockProcessor struct {
+	splits chan split
+	// release when set, each split waits for a value on it before finishing.
+	release chan struct{}
+}
+
+func (processor *mockProcessor) Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string, version string) error {
+	processor.splits <- split{event: event, datasetID: datasetID}
+	if processor.release != nil {
+		<-processor.release
+	}
+	return nil
+}
+
+func (processor *mockProcessor) Resume(r io.Reader, event *event.FileUploaded, startTime time.Time, checkpoint *splitter.Checkpoint) error {
+	return processor.Process(r, event, startTime, checkpoint.DatasetID, checkpoint.Version)
+}
+
+type mockSource struct{}
+
+func (s mockSource) Open(url *url.URL, offset int64) (*source.File, error) {
+	if strings.HasSuffix(url.Path, "missing.csv") {
+		return nil, errors.New("file not found")
+	}
+	return &source.File{ReadCloser: ioutil.NopCloser(strings.NewReader("Observation\n1\n")), Version: "\"etag\""}, nil
+}
+
+func TestSplitHandler(t *testing.T) {
+	sources := source.NewRegistry()
+	sources.Register(mockSource{}, "s3", "file")
+
+	Convey("Given a split handler that allows files from a bucket to be split to a topic", t, func() {
+		defaultBuckets, defaultTopics, defaultConcurrency := config.SplitAPIBuckets, config.SplitAPITopics, config.SplitAPIConcurrency
+		defaultJobs, defaultDeterministicIDs := splitter.Jobs, config.DeterministicIDs
+		config.SplitAPIBuckets, config.SplitAPITopics = []string{"bucket"}, []string{"rows"}
+		splitter.Jobs = splitter.NewJobRegistry()
+		Reset(func() {
+			config.SplitAPIBuckets, config.SplitAPITopics, config.SplitAPIConcurrency = defaultBuckets, defaultTopics, defaultConcurrency
+			splitter.Jobs, config.DeterministicIDs = defaultJobs, defaultDeterministicIDs
+		})
+
+		processor := &mockProcessor{splits: make(chan split, 2)}
+		handler := SplitHandler(sources, processor)
+
+		post := func(body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("POST", "/split", strings.NewReader(body)))
+			return w
+		}
+
+		Convey("When a split of a file is requested with overrides", func() {
+			w := post(`{"s3URL": "s3://bucket/test.csv", "datasetID": "dataset", "topic": "rows", "batchSize": 10}`)
+
+			Convey("Then the dataset ID is returned as the job ID", func() {
+				So(w.Code, ShouldEqual, http.StatusAccepted)
+				var body SplitResponse
+				So(json.Unmarshal(w.Body.Bytes(), &body), ShouldBeNil)
+				So(body.JobID, ShouldEqual, "dataset")
+			})
+
+			Convey("Then the file is split with the overrides", func() {
+				requested := <-processor.splits
+				So(requested.event.GetURL(), ShouldEqual, "s3://bucket/test.csv")
+				So(requested.datasetID, ShouldEqual, "dataset")
+				So(requested.event.Topic, ShouldEqual, "rows")
+				So(requested.event.BatchSize, ShouldEqual, 10)
+			})
+
+			Convey("Then the dataset cannot be split again until the split has finished", func() {
+				So(post(`{"s3URL": "s3://bucket/test.csv", "datasetID": "dataset"}`).Code, ShouldEqual, http.StatusConflict)
+			})
+		})
+
+		Convey("When a split is requested without a dataset ID", func() {
+			config.DeterministicIDs = true
+			w := post(`{"s3URL": "s3://bucket/test.csv"}`)
+
+			Convey("Then the dataset ID is derived from the file as it is for an event", func() {
+				So(w.Code, ShouldEqual, http.StatusAccepted)
+				var body SplitResponse
+				So(json.Unmarshal(w.Body.Bytes(), &body), ShouldBeNil)
+				So(body.JobID, ShouldEqual, splitter.NewDatasetID("s3://bucket/test.csv", "\"etag\""))
+				So((<-processor.splits).datasetID, ShouldEqual, body.JobID)
+			})
+
+			Convey("Then its job is queued", func() {
+				var body SplitResponse
+				json.Unmarshal(w.Body.Bytes(), &body)
+				_, ok := splitter.Jobs.Get(body.JobID)
+				So(ok, ShouldBeTrue)
+			})
+		})
+
+		Convey("When a split of a file that cannot be opened is requested", func() {
+			w := post(`{"s3URL": "s3://bucket/missing.csv"}`)
+
+			Convey("Then a 502 is returned and its job records the error", func() {
+				So(w.Code, ShouldEqual, http.StatusBadGateway)
+				jobs := splitter.Jobs.List()
+				So(jobs, ShouldHaveLength, 1)
+				So(jobs[0].State, ShouldEqual, splitter.JobFailed)
+				So(jobs[0].LastError, ShouldEqual, "file not found")
+			})
+		})
+
+		Convey("When more splits are requested than may run at once", func() {
+			config.SplitAPIConcurrency = 1
+			processor.release = make(chan struct{})
+			handler = SplitHandler(sources, processor)
+
+			first := post(`{"s3URL": "s3://bucket/first.csv"}`)
+			second := post(`{"s3URL": "s3://bucket/second.csv"}`)
+			close(processor.release)
+
+			Convey("Then the splits beyond the limit are refused", func() {
+				So(first.Code, ShouldEqual, http.StatusAccepted)
+				So(second.Code, ShouldEqual, http.StatusServiceUnavailable)
+			})
+		})
+
+		Convey("When an invalid split is requested", func() {
+			Convey("Then a 400 is returned", func() {
+				So(post(`not json`).Code, ShouldEqual, http.StatusBadRequest)
+				So(post(`{"s3URL": "ftp://bucket/file.csv"}`).Code, ShouldEqual, http.StatusBadRequest)
+				So(post(`{"s3URL": "s3://bucket/file.csv", "batchSize": -1}`).Code, ShouldEqual, http.StatusBadRequest)
+				So(post(`{"s3URL": "s3://bucket/file.csv", "batchSize": 2000000000}`).Code, ShouldEqual, http.StatusBadRequest)
+				So(post(`{"s3URL": "s3://bucket/archive.zip"}`).Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When a split of a file the API does not allow is requested", func() {
+			Convey("Then a 400 is returned without the file being opened", func() {
+				So(post(`{"s3URL": "file:///etc/passwd"}`).Code, ShouldEqual, http.StatusBadRequest)
+				So(post(`{"s3URL": "s3://other-bucket/test.csv"}`).Code, ShouldEqual, http.StatusBadRequest)
+				So(post(`{"s3URL": "s3://bucket/test.csv", "topic": "other-topic"}`).Code, ShouldEqual, http.StatusBadRequest)
+				So(processor.splits, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,163 @@
+package charset
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Character encodings that can be transcoded to UTF-8.
+const (
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1252 = "windows-1252"
+	ISO88591    = "iso-8859-1"
+)
+
+// ErrUnsupportedEncoding is returned for an encoding name that is not supported.
+var ErrUnsupportedEncoding = errors.New("unsupported character encoding")
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+var aliases = map[string]string{
+	"utf8":         UTF8,
+	"utf-8":        UTF8,
+	"utf-16le":     UTF16LE,
+	"utf-16be":     UTF16BE,
+	"windows-1252": Windows1252,
+	"cp1252":       Windows1252,
+	"iso-8859-1":   ISO88591,
+	"latin1":       ISO88591,
+}
+
+// Normalise returns the canonical name of an encoding, or an empty string if name is empty.
+func Normalise(name string) (string, error) {
+	if len(name) == 0 {
+		return "", nil
+	}
+	encoding, ok := aliases[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return "", ErrUnsupportedEncoding
+	}
+	return encoding, nil
+}
+
+// ReadBOM consumes a byte order mark from the start of r, returning the encoding it identifies and its length. An
+// empty encoding is returned when there is no byte order mark.
+func ReadBOM(r *bufio.Reader) (string, int, error) {
+	for _, bom := range []struct {
+		encoding string
+		mark     []byte
+	}{{UTF8, bomUTF8}, {UTF16LE, bomUTF16LE}, {UTF16BE, bomUTF16BE}} {
+		if peeked, _ := r.Peek(len(bom.mark)); bytes.Equal(peeked, bom.mark) {
+			_, err := r.Discard(len(bom.mark))
+			return bom.encoding, len(bom.mark), err
+		}
+	}
+	return "", 0, nil
+}
+
+// IsUTF16 returns whether the encoding is one of the UTF-16 encodings, which must be transcoded as a stream rather
+// than one record at a time.
+func IsUTF16(encoding string) bool {
+	return encoding == UTF16LE || encoding == UTF16BE
+}
+
+// DecodeString transcodes s from a single byte encoding to UTF-8. When encoding is empty s is returned unchanged if
+// it is valid UTF-8, otherwise it is assumed to be Windows-1252, the most common encoding of files from Windows tools.
+func DecodeString(s string, encoding string) string {
+	switch encoding {
+	case Windows1252:
+		return decodeSingleByte(s, &windows1252)
+	case ISO88591:
+		return decodeSingleByte(s, nil)
+	case "":
+		if utf8.ValidString(s) {
+			return s
+		}
+		return decodeSingleByte(s, &windows1252)
+	default:
+		return s
+	}
+}
+
+func decodeSingleByte(s string, table *[32]rune) string {
+	var decoded bytes.Buffer
+	decoded.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if table != nil && b >= 0x80 && b < 0xa0 {
+			decoded.WriteRune(table[b-0x80])
+		} else {
+			decoded.WriteRune(rune(b))
+		}
+	}
+	return decoded.String()
+}
+
+// windows1252 the characters of bytes 0x80 to 0x9f, the only range where Windows-1252 differs from ISO-8859-1.
+// Undefined bytes are mapped to the C1 control with the same value.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// NewUTF16Reader returns a reader of the UTF-8 transcoding of the UTF-16 text read from r.
+func NewUTF16Reader(r io.Reader, encoding string) io.Reader {
+	return &utf16Reader{reader: bufio.NewReader(r), bigEndian: encoding == UTF16BE}
+}
+
+type utf16Reader struct {
+	reader    *bufio.Reader
+	bigEndian bool
+	pending   []byte
+}
+
+func (r *utf16Reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		unit, err := r.readUnit()
+		if err != nil {
+			return 0, err
+		}
+
+		decoded := rune(unit)
+		if utf16.IsSurrogate(decoded) {
+			low, err := r.readUnit()
+			if err != nil && err != io.EOF {
+				return 0, err
+			}
+			decoded = utf16.DecodeRune(decoded, rune(low))
+		}
+
+		var encoded [utf8.UTFMax]byte
+		n := utf8.EncodeRune(encoded[:], decoded)
+		r.pending = append(r.pending, encoded[:n]...)
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *utf16Reader) readUnit() (uint16, error) {
+	var unit [2]byte
+	if _, err := io.ReadFull(r.reader, unit[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	if r.bigEndian {
+		return uint16(unit[0])<<8 | uint16(unit[1]), nil
+	}
+	return uint16(unit[1])<<8 | uint16(unit[0]), nil
+}
@@ -0,0 +1,95 @@
+package charset_test
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/ONSdigital/dp-csv-splitter/charset"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func encodeUTF16LE(s string) []byte {
+	var b []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(unit), byte(unit>>8))
+	}
+	return b
+}
+
+func TestReadBOM(t *testing.T) {
+
+	Convey("Given a UTF-16LE file with a byte order mark", t, func() {
+		r := bufio.NewReader(bytes.NewReader(append([]byte{0xff, 0xfe}, encodeUTF16LE("a,b")...)))
+
+		Convey("When the byte order mark is read", func() {
+			encoding, length, err := charset.ReadBOM(r)
+
+			Convey("Then the encoding is identified and the mark consumed", func() {
+				So(err, ShouldBeNil)
+				So(encoding, ShouldEqual, charset.UTF16LE)
+				So(length, ShouldEqual, 2)
+				So(r.Buffered(), ShouldEqual, 6)
+			})
+		})
+	})
+
+	Convey("Given a file without a byte order mark", t, func() {
+		r := bufio.NewReader(bytes.NewReader([]byte("a,b")))
+
+		Convey("When the byte order mark is read", func() {
+			encoding, length, err := charset.ReadBOM(r)
+
+			Convey("Then nothing is consumed", func() {
+				So(err, ShouldBeNil)
+				So(encoding, ShouldBeEmpty)
+				So(length, ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestNewUTF16Reader(t *testing.T) {
+
+	Convey("Given UTF-16LE text with Welsh characters and a surrogate pair", t, func() {
+		text := "Gŵyl,Dŷ,𝄞\n"
+		r := charset.NewUTF16Reader(bytes.NewReader(encodeUTF16LE(text)), charset.UTF16LE)
+
+		Convey("Then it is transcoded to UTF-8", func() {
+			b, err := ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, text)
+		})
+	})
+}
+
+func TestDecodeString(t *testing.T) {
+
+	Convey("Given a Windows-1252 row", t, func() {
+		row := string([]byte{'C', 'a', 'f', 0xe9, ',', 0x93, 'q', 0x94, ',', 0x80})
+
+		Convey("When it is decoded without a known encoding", func() {
+			decoded := charset.DecodeString(row, "")
+
+			Convey("Then it is detected as Windows-1252 and transcoded", func() {
+				So(decoded, ShouldEqual, "Café,“q”,€")
+			})
+		})
+	})
+
+	Convey("Given a valid UTF-8 row", t, func() {
+		Convey("Then it is returned unchanged", func() {
+			So(charset.DecodeString("Gŵyl,Dŷ", ""), ShouldEqual, "Gŵyl,Dŷ")
+		})
+	})
+
+	Convey("Given an unknown encoding name", t, func() {
+		_, err := charset.Normalise("ebcdic")
+
+		Convey("Then an unsupported encoding error is returned", func() {
+			So(err, ShouldEqual, charset.ErrUnsupportedEncoding)
+		})
+	})
+}
@@ -2,6 +2,7 @@
 
 export BINPATH=$(pwd)/bin
 export GOPATH=$(pwd)/go
+export GO111MODULE=off
 
 pushd $GOPATH/src/github.com/ONSdigital/dp-csv-splitter
   go build -o $BINPATH/dp-csv-splitter
@@ -1,6 +1,7 @@
 #!/bin/bash -eux
 
 export GOPATH=$(pwd)/go
+export GO111MODULE=off
 
 pushd $GOPATH/src/github.com/ONSdigital/dp-csv-splitter
   go test ./...
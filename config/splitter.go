@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ONSdigital/go-ns/log"
 )
@@ -12,9 +15,36 @@ const kafkaAddrKey = "KAFKA_ADDR"
 const kafkaConsumerGroup = "KAFKA_CONSUMER_GROUP"
 const kafkaConsumerTopic = "KAFKA_CONSUMER_TOPIC"
 const awsRegionKey = "AWS_REGION"
+const awsEndpointKey = "AWS_ENDPOINT"
+const awsS3ForcePathStyleKey = "AWS_S3_FORCE_PATH_STYLE"
+const awsCredentialsProfileKey = "AWS_CREDENTIALS_PROFILE"
+const awsBucketRegionsKey = "AWS_BUCKET_REGIONS"
 const rowTopicNameKey = "TOPIC_NAME"
 const datasetTopicNameKey = "DATASET_TOPIC_NAME"
+const sendStartedEventsKey = "SEND_STARTED_EVENTS"
 const batchSizeKey = "BATCH_SIZE"
+const maxBatchSizeKey = "MAX_BATCH_SIZE"
+const maxRowSizeKey = "MAX_ROW_SIZE"
+const maxRetriesKey = "MAX_RETRIES"
+const retryIntervalKey = "RETRY_INTERVAL"
+const parkedTopicNameKey = "PARKED_TOPIC_NAME"
+const checkpointDirKey = "CHECKPOINT_DIR"
+const deterministicIDsKey = "DETERMINISTIC_IDS"
+const partitionKeyKey = "PARTITION_KEY"
+const rowFormatKey = "ROW_FORMAT"
+const schemaKey = "SCHEMA"
+const rowDeadLetterTopicNameKey = "ROW_DEAD_LETTER_TOPIC_NAME"
+const eventDeadLetterTopicNameKey = "EVENT_DEAD_LETTER_TOPIC_NAME"
+const healthcheckBucketKey = "HEALTHCHECK_BUCKET"
+const healthcheckTimeoutKey = "HEALTHCHECK_TIMEOUT"
+const jobHistorySizeKey = "JOB_HISTORY_SIZE"
+const enableFileSourceKey = "ENABLE_FILE_SOURCE"
+const httpSourceTimeoutKey = "HTTP_SOURCE_TIMEOUT"
+const httpSourceConnectTimeoutKey = "HTTP_SOURCE_CONNECT_TIMEOUT"
+const splitAPISchemesKey = "SPLIT_API_SCHEMES"
+const splitAPIBucketsKey = "SPLIT_API_BUCKETS"
+const splitAPITopicsKey = "SPLIT_API_TOPICS"
+const splitAPIConcurrencyKey = "SPLIT_API_CONCURRENCY"
 
 // BindAddr the address to bind to.
 var BindAddr = ":21000"
@@ -31,15 +61,110 @@ var KafkaConsumerTopic = "file-uploaded"
 // AWSRegion the AWS region to use.
 var AWSRegion = "eu-west-1"
 
+// AWSEndpoint a custom S3 endpoint URL, such as a local MinIO or localstack. The AWS default is used when empty.
+var AWSEndpoint = ""
+
+// AWSS3ForcePathStyle use path-style S3 addressing (http://host/bucket/key), as most S3 compatible servers require.
+var AWSS3ForcePathStyle = false
+
+// AWSCredentialsProfile the shared credentials profile to use. The default credential chain is used when empty.
+var AWSCredentialsProfile = ""
+
+// AWSBucketRegions the regions of buckets that are not in AWSRegion, keyed by bucket name.
+var AWSBucketRegions = map[string]string{}
+
 // RowTopicName the name of the Kafka topic to send row messages to.
 var RowTopicName = "test"
 
 // RowTopicName the name of the Kafka topic to send row messages to.
 var DatasetTopicName = "dataset-status"
 
+// SendStartedEvents send a dataset event with the status "started" to DatasetTopicName before the rows of a file are
+// sent. Consumers that expect only completion messages on the topic need it turned off.
+var SendStartedEvents = true
+
 // BatchSize the number of CSV lines to process in a single batch.
 var BatchSize int = 100
 
+// MaxBatchSize the largest batch size an event, or a split requested through the split API, may ask for.
+var MaxBatchSize int = 10000
+
+// MaxRowSize the maximum size in bytes of a single CSV row. Rows larger than this are sent to the row dead letter topic.
+var MaxRowSize int = 10 * 1024 * 1024
+
+// MaxRetries the number of times a failed message is retried before it is parked.
+var MaxRetries int = 3
+
+// RetryInterval the time to wait between retries of a failed message.
+var RetryInterval = 5 * time.Second
+
+// ParkedTopicName the name of the Kafka topic to park messages on once their retries are exhausted.
+var ParkedTopicName = "file-uploaded-parked"
+
+// CheckpointDir the directory to save split checkpoints to. Checkpointing is disabled when empty.
+var CheckpointDir = ""
+
+// DeterministicIDs derive the dataset and row IDs from the file and row index rather than generating random IDs, so
+// re-processing the same file produces identical messages.
+var DeterministicIDs = false
+
+// PartitionKey the strategy used to key messages sent to Kafka, one of "dataset", "dimensions" or "roundrobin".
+var PartitionKey = "dataset"
+
+// PartitionKeys the strategies PartitionKey may be set to.
+var PartitionKeys = []string{"dataset", "dimensions", "roundrobin"}
+
+// RowFormat how each row is sent, "raw" for the text of the row, "map" for its fields keyed by column name, or
+// "dimensions" for the text of the row along with its structured v4 dimensions.
+var RowFormat = "raw"
+
+// RowFormats the formats RowFormat may be set to.
+var RowFormats = []string{"raw", "map", "dimensions"}
+
+// Schema the schema that rows are validated against, such as "v4". Rows are not validated when empty.
+var Schema = ""
+
+// Schemas the schemas Schema may be set to other than empty, which must each be known to splitter.NewValidator.
+var Schemas = []string{"v4"}
+
+// RowDeadLetterTopicName the name of the Kafka topic to send rows that could not be parsed, decoded or validated to.
+var RowDeadLetterTopicName = "row-dead-letter"
+
+// EventDeadLetterTopicName the name of the Kafka topic to send file-uploaded messages that are not valid events to.
+var EventDeadLetterTopicName = "file-uploaded-dead-letter"
+
+// HealthcheckBucket an S3 bucket the health check verifies can be accessed. Only the AWS credentials are checked
+// when empty.
+var HealthcheckBucket = ""
+
+// HealthcheckTimeout the time each health check has to complete before it is reported as failed.
+var HealthcheckTimeout = 5 * time.Second
+
+// JobHistorySize the number of finished splits kept in the job registry, in addition to those in progress.
+var JobHistorySize = 100
+
+// EnableFileSource allow files to be split from the local disk with file:// URLs, for development only.
+var EnableFileSource = false
+
+// HTTPSourceTimeout the time an http:// or https:// file has to be downloaded, including reading its body.
+var HTTPSourceTimeout = time.Hour
+
+// HTTPSourceConnectTimeout the time an HTTP file server has to accept a connection, and then to respond with headers.
+var HTTPSourceConnectTimeout = 30 * time.Second
+
+// SplitAPISchemes the URL schemes of the files that may be split through the split API.
+var SplitAPISchemes = []string{"s3"}
+
+// SplitAPIBuckets the S3 buckets, or HTTP hosts, of the files that may be split through the split API. No file may be
+// split through the API when empty.
+var SplitAPIBuckets = []string{}
+
+// SplitAPITopics the topics, other than RowTopicName, that a split requested through the split API may send rows to.
+var SplitAPITopics = []string{}
+
+// SplitAPIConcurrency the number of splits requested through the split API that may run at once.
+var SplitAPIConcurrency = 4
+
 func init() {
 	if bindAddrEnv := os.Getenv(bindAddrKey); len(bindAddrEnv) > 0 {
 		BindAddr = bindAddrEnv
@@ -53,6 +178,35 @@ func init() {
 		AWSRegion = awsRegionEnv
 	}
 
+	if awsEndpointEnv := os.Getenv(awsEndpointKey); len(awsEndpointEnv) > 0 {
+		AWSEndpoint = awsEndpointEnv
+	}
+
+	if forcePathStyleEnv := os.Getenv(awsS3ForcePathStyleKey); len(forcePathStyleEnv) > 0 {
+		forcePathStyle, err := strconv.ParseBool(forcePathStyleEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse S3 force path style flag. Using default."})
+		} else {
+			AWSS3ForcePathStyle = forcePathStyle
+		}
+	}
+
+	if credentialsProfileEnv := os.Getenv(awsCredentialsProfileKey); len(credentialsProfileEnv) > 0 {
+		AWSCredentialsProfile = credentialsProfileEnv
+	}
+
+	// Bucket regions are given as a comma separated list of bucket=region pairs.
+	if bucketRegionsEnv := os.Getenv(awsBucketRegionsKey); len(bucketRegionsEnv) > 0 {
+		for _, pair := range strings.Split(bucketRegionsEnv, ",") {
+			bucketRegion := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(bucketRegion) != 2 {
+				log.Debug("Ignoring invalid bucket region", log.Data{awsBucketRegionsKey: pair})
+				continue
+			}
+			AWSBucketRegions[bucketRegion[0]] = bucketRegion[1]
+		}
+	}
+
 	if topicNameEnv := os.Getenv(rowTopicNameKey); len(topicNameEnv) > 0 {
 		RowTopicName = topicNameEnv
 	}
@@ -61,6 +215,15 @@ func init() {
 		DatasetTopicName = datasetTopicNameEnv
 	}
 
+	if sendStartedEventsEnv := os.Getenv(sendStartedEventsKey); len(sendStartedEventsEnv) > 0 {
+		sendStartedEvents, err := strconv.ParseBool(sendStartedEventsEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse send started events flag. Using default."})
+		} else {
+			SendStartedEvents = sendStartedEvents
+		}
+	}
+
 	if consumerGroupEnv := os.Getenv(kafkaConsumerGroup); len(consumerGroupEnv) > 0 {
 		KafkaConsumerGroup = consumerGroupEnv
 	}
@@ -75,18 +238,226 @@ func init() {
 	} else {
 		BatchSize = batchSizeEnv
 	}
+
+	if maxBatchSizeEnv := os.Getenv(maxBatchSizeKey); len(maxBatchSizeEnv) > 0 {
+		maxBatchSize, err := strconv.Atoi(maxBatchSizeEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse max batch size. Using default."})
+		} else {
+			MaxBatchSize = maxBatchSize
+		}
+	}
+
+	if maxRowSizeEnv := os.Getenv(maxRowSizeKey); len(maxRowSizeEnv) > 0 {
+		maxRowSize, err := strconv.Atoi(maxRowSizeEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse max row size. Using default."})
+		} else {
+			MaxRowSize = maxRowSize
+		}
+	}
+
+	if maxRetriesEnv := os.Getenv(maxRetriesKey); len(maxRetriesEnv) > 0 {
+		maxRetries, err := strconv.Atoi(maxRetriesEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse max retries. Using default."})
+		} else {
+			MaxRetries = maxRetries
+		}
+	}
+
+	if retryIntervalEnv := os.Getenv(retryIntervalKey); len(retryIntervalEnv) > 0 {
+		retryInterval, err := time.ParseDuration(retryIntervalEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse retry interval. Using default."})
+		} else {
+			RetryInterval = retryInterval
+		}
+	}
+
+	if parkedTopicNameEnv := os.Getenv(parkedTopicNameKey); len(parkedTopicNameEnv) > 0 {
+		ParkedTopicName = parkedTopicNameEnv
+	}
+
+	if checkpointDirEnv := os.Getenv(checkpointDirKey); len(checkpointDirEnv) > 0 {
+		CheckpointDir = checkpointDirEnv
+	}
+
+	if deterministicIDsEnv := os.Getenv(deterministicIDsKey); len(deterministicIDsEnv) > 0 {
+		deterministicIDs, err := strconv.ParseBool(deterministicIDsEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse deterministic IDs flag. Using default."})
+		} else {
+			DeterministicIDs = deterministicIDs
+		}
+	}
+
+	if partitionKeyEnv := os.Getenv(partitionKeyKey); len(partitionKeyEnv) > 0 {
+		PartitionKey = partitionKeyEnv
+	}
+
+	if rowFormatEnv := os.Getenv(rowFormatKey); len(rowFormatEnv) > 0 {
+		RowFormat = rowFormatEnv
+	}
+
+	if schemaEnv := os.Getenv(schemaKey); len(schemaEnv) > 0 {
+		Schema = schemaEnv
+	}
+
+	if rowDeadLetterTopicNameEnv := os.Getenv(rowDeadLetterTopicNameKey); len(rowDeadLetterTopicNameEnv) > 0 {
+		RowDeadLetterTopicName = rowDeadLetterTopicNameEnv
+	}
+
+	if eventDeadLetterTopicNameEnv := os.Getenv(eventDeadLetterTopicNameKey); len(eventDeadLetterTopicNameEnv) > 0 {
+		EventDeadLetterTopicName = eventDeadLetterTopicNameEnv
+	}
+
+	if healthcheckBucketEnv := os.Getenv(healthcheckBucketKey); len(healthcheckBucketEnv) > 0 {
+		HealthcheckBucket = healthcheckBucketEnv
+	}
+
+	if healthcheckTimeoutEnv := os.Getenv(healthcheckTimeoutKey); len(healthcheckTimeoutEnv) > 0 {
+		healthcheckTimeout, err := time.ParseDuration(healthcheckTimeoutEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse health check timeout. Using default."})
+		} else {
+			HealthcheckTimeout = healthcheckTimeout
+		}
+	}
+
+	if jobHistorySizeEnv := os.Getenv(jobHistorySizeKey); len(jobHistorySizeEnv) > 0 {
+		jobHistorySize, err := strconv.Atoi(jobHistorySizeEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse job history size. Using default."})
+		} else {
+			JobHistorySize = jobHistorySize
+		}
+	}
+
+	if enableFileSourceEnv := os.Getenv(enableFileSourceKey); len(enableFileSourceEnv) > 0 {
+		enableFileSource, err := strconv.ParseBool(enableFileSourceEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse enable file source flag. Using default."})
+		} else {
+			EnableFileSource = enableFileSource
+		}
+	}
+
+	if httpSourceTimeoutEnv := os.Getenv(httpSourceTimeoutKey); len(httpSourceTimeoutEnv) > 0 {
+		httpSourceTimeout, err := time.ParseDuration(httpSourceTimeoutEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse HTTP source timeout. Using default."})
+		} else {
+			HTTPSourceTimeout = httpSourceTimeout
+		}
+	}
+
+	if httpSourceConnectTimeoutEnv := os.Getenv(httpSourceConnectTimeoutKey); len(httpSourceConnectTimeoutEnv) > 0 {
+		httpSourceConnectTimeout, err := time.ParseDuration(httpSourceConnectTimeoutEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse HTTP source connect timeout. Using default."})
+		} else {
+			HTTPSourceConnectTimeout = httpSourceConnectTimeout
+		}
+	}
+
+	if splitAPISchemesEnv := os.Getenv(splitAPISchemesKey); len(splitAPISchemesEnv) > 0 {
+		SplitAPISchemes = splitList(splitAPISchemesEnv)
+	}
+
+	if splitAPIBucketsEnv := os.Getenv(splitAPIBucketsKey); len(splitAPIBucketsEnv) > 0 {
+		SplitAPIBuckets = splitList(splitAPIBucketsEnv)
+	}
+
+	if splitAPITopicsEnv := os.Getenv(splitAPITopicsKey); len(splitAPITopicsEnv) > 0 {
+		SplitAPITopics = splitList(splitAPITopicsEnv)
+	}
+
+	if splitAPIConcurrencyEnv := os.Getenv(splitAPIConcurrencyKey); len(splitAPIConcurrencyEnv) > 0 {
+		splitAPIConcurrency, err := strconv.Atoi(splitAPIConcurrencyEnv)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to parse split API concurrency. Using default."})
+		} else {
+			SplitAPIConcurrency = splitAPIConcurrency
+		}
+	}
 }
 
-func Load() {
+// splitList returns the values of a comma separated list, without any surrounding whitespace or empty values.
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Load logs the configuration, returning an error if a setting has a value the splitter does not support.
+func Load() error {
 	// Will call init().
 	log.Debug("dp-csv-splitter Configuration", log.Data{
-		bindAddrKey:         BindAddr,
-		kafkaAddrKey:        KafkaAddr,
-		kafkaConsumerGroup:  KafkaConsumerGroup,
-		kafkaConsumerTopic:  KafkaConsumerTopic,
-		awsRegionKey:        AWSRegion,
-		rowTopicNameKey:     RowTopicName,
-		datasetTopicNameKey: DatasetTopicName,
-		batchSizeKey:        BatchSize,
+		bindAddrKey:                 BindAddr,
+		kafkaAddrKey:                KafkaAddr,
+		kafkaConsumerGroup:          KafkaConsumerGroup,
+		kafkaConsumerTopic:          KafkaConsumerTopic,
+		awsRegionKey:                AWSRegion,
+		awsEndpointKey:              AWSEndpoint,
+		awsS3ForcePathStyleKey:      AWSS3ForcePathStyle,
+		awsCredentialsProfileKey:    AWSCredentialsProfile,
+		awsBucketRegionsKey:         AWSBucketRegions,
+		rowTopicNameKey:             RowTopicName,
+		datasetTopicNameKey:         DatasetTopicName,
+		sendStartedEventsKey:        SendStartedEvents,
+		batchSizeKey:                BatchSize,
+		maxBatchSizeKey:             MaxBatchSize,
+		maxRowSizeKey:               MaxRowSize,
+		maxRetriesKey:               MaxRetries,
+		retryIntervalKey:            RetryInterval.String(),
+		parkedTopicNameKey:          ParkedTopicName,
+		checkpointDirKey:            CheckpointDir,
+		deterministicIDsKey:         DeterministicIDs,
+		partitionKeyKey:             PartitionKey,
+		rowFormatKey:                RowFormat,
+		schemaKey:                   Schema,
+		rowDeadLetterTopicNameKey:   RowDeadLetterTopicName,
+		eventDeadLetterTopicNameKey: EventDeadLetterTopicName,
+		healthcheckBucketKey:        HealthcheckBucket,
+		healthcheckTimeoutKey:       HealthcheckTimeout.String(),
+		jobHistorySizeKey:           JobHistorySize,
+		enableFileSourceKey:         EnableFileSource,
+		httpSourceTimeoutKey:        HTTPSourceTimeout.String(),
+		httpSourceConnectTimeoutKey: HTTPSourceConnectTimeout.String(),
+		splitAPISchemesKey:          SplitAPISchemes,
+		splitAPIBucketsKey:          SplitAPIBuckets,
+		splitAPITopicsKey:           SplitAPITopics,
+		splitAPIConcurrencyKey:      SplitAPIConcurrency,
 	})
+
+	if !contains(PartitionKeys, PartitionKey) {
+		return fmt.Errorf("unknown %s %q, expected one of %s", partitionKeyKey, PartitionKey, strings.Join(PartitionKeys, ", "))
+	}
+	if !contains(RowFormats, RowFormat) {
+		return fmt.Errorf("unknown %s %q, expected one of %s", rowFormatKey, RowFormat, strings.Join(RowFormats, ", "))
+	}
+	if len(Schema) > 0 && !contains(Schemas, Schema) {
+		return fmt.Errorf("unknown %s %q, expected one of %s, or empty to not validate rows", schemaKey, Schema, strings.Join(Schemas, ", "))
+	}
+	if BatchSize < 1 || BatchSize > MaxBatchSize {
+		return fmt.Errorf("%s must be between 1 and %s (%d)", batchSizeKey, maxBatchSizeKey, MaxBatchSize)
+	}
+	if SplitAPIConcurrency < 1 {
+		return fmt.Errorf("%s must be at least 1", splitAPIConcurrencyKey)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoad(t *testing.T) {
+	Convey("Given the default configuration", t, func() {
+		partitionKey, rowFormat, schema := PartitionKey, RowFormat, Schema
+		Reset(func() { PartitionKey, RowFormat, Schema = partitionKey, rowFormat, schema })
+
+		Convey("Then it loads without error", func() {
+			So(Load(), ShouldBeNil)
+		})
+
+		Convey("When PartitionKey is set to an unknown strategy", func() {
+			PartitionKey = "dimension"
+
+			Convey("Then an error is returned", func() {
+				So(Load(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When RowFormat is set to an unknown format", func() {
+			RowFormat = "json"
+
+			Convey("Then an error is returned", func() {
+				So(Load(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When Schema is set to an unknown schema", func() {
+			Schema = "v3"
+
+			Convey("Then an error is returned", func() {
+				So(Load(), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ONSdigital/go-ns/handlers/response"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// Statuses reported for the service and each of its dependencies.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// ErrTimeout is reported for a check that does not finish within the timeout.
+var ErrTimeout = errors.New("health check timed out")
+
+// Check a named check of a dependency, which returns an error if the dependency is unavailable.
+type Check struct {
+	Name  string
+	Check func() error
+}
+
+// CheckStatus the result of a single Check.
+type CheckStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report the response of the health check endpoint.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckStatus `json:"checks"`
+}
+
+// Handler returns a handler that runs the checks concurrently and reports their results. The status code is 200 if
+// every check passes, otherwise 503 so an orchestrator can restart the service. A check that takes longer than
+// timeout is reported as failed.
+func Handler(timeout time.Duration, checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		report := Run(timeout, checks...)
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+			log.Debug("Health check failed", log.Data{"checks": report.Checks})
+		}
+
+		if err := response.WriteJSON(w, report, status); err != nil {
+			log.Error(err, log.Data{"message": "Failed to write health check response"})
+		}
+	}
+}
+
+// Run runs the checks concurrently and returns a report of their results.
+func Run(timeout time.Duration, checks ...Check) Report {
+	results := make([]chan error, len(checks))
+	for i, check := range checks {
+		// Buffered so a check that times out can still finish without blocking.
+		results[i] = make(chan error, 1)
+		go func(check Check, result chan<- error) {
+			result <- check.Check()
+		}(check, results[i])
+	}
+
+	report := Report{Status: StatusOK, Checks: make([]CheckStatus, len(checks))}
+	deadline := time.After(timeout)
+	for i, check := range checks {
+		var err error
+		select {
+		case err = <-results[i]:
+		case <-deadline:
+			err = ErrTimeout
+		}
+
+		report.Checks[i] = CheckStatus{Name: check.Name, Status: StatusOK}
+		if err != nil {
+			report.Status = StatusError
+			report.Checks[i].Status = StatusError
+			report.Checks[i].Error = err.Error()
+		}
+	}
+	return report
+}
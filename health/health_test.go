@@ -0,0 +1,52 @@
+package health_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-csv-splitter/health"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHandler(t *testing.T) {
+	ok := health.Check{Name: "ok", Check: func() error { return nil }}
+	failing := health.Check{Name: "failing", Check: func() error { return errors.New("unreachable") }}
+	slow := health.Check{Name: "slow", Check: func() error {
+		time.Sleep(time.Second)
+		return nil
+	}}
+
+	Convey("Given every dependency is available", t, func() {
+		recorder := httptest.NewRecorder()
+		health.Handler(time.Second, ok, ok)(recorder, httptest.NewRequest("GET", "/healthcheck", nil))
+
+		Convey("Then the health check returns 200", func() {
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			var report health.Report
+			So(json.Unmarshal(recorder.Body.Bytes(), &report), ShouldBeNil)
+			So(report.Status, ShouldEqual, health.StatusOK)
+			So(len(report.Checks), ShouldEqual, 2)
+		})
+	})
+
+	Convey("Given a dependency is unavailable and another is too slow", t, func() {
+		recorder := httptest.NewRecorder()
+		health.Handler(10*time.Millisecond, ok, failing, slow)(recorder, httptest.NewRequest("GET", "/healthcheck", nil))
+
+		Convey("Then the health check returns 503 with the status of each dependency", func() {
+			So(recorder.Code, ShouldEqual, http.StatusServiceUnavailable)
+			var report health.Report
+			So(json.Unmarshal(recorder.Body.Bytes(), &report), ShouldBeNil)
+			So(report.Status, ShouldEqual, health.StatusError)
+			So(report.Checks, ShouldResemble, []health.CheckStatus{
+				{Name: "ok", Status: health.StatusOK},
+				{Name: "failing", Status: health.StatusError, Error: "unreachable"},
+				{Name: "slow", Status: health.StatusError, Error: health.ErrTimeout.Error()},
+			})
+		})
+	})
+}
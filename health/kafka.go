@@ -0,0 +1,64 @@
+package health
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// KafkaProducerCheck returns a check that refreshes the broker metadata of the producer's client and that each of the
+// topics it sends to has a partition with a leader to write to.
+func KafkaProducerCheck(client sarama.Client, topics ...string) func() error {
+	return func() error {
+		if client.Closed() {
+			return fmt.Errorf("kafka client is closed")
+		}
+		if err := client.RefreshMetadata(topics...); err != nil {
+			return err
+		}
+		for _, topic := range topics {
+			partitions, err := client.WritablePartitions(topic)
+			if err != nil {
+				return err
+			}
+			if len(partitions) == 0 {
+				return fmt.Errorf("no writable partitions for topic %s", topic)
+			}
+		}
+		return nil
+	}
+}
+
+// ConsumerGroupCheck returns a check that asks the group coordinator whether a consumer with the client ID is a member
+// of the consumer group. Each instance of the service must use its own client ID.
+func ConsumerGroupCheck(client sarama.Client, group string, clientID string) func() error {
+	return func() error {
+		if client.Closed() {
+			return fmt.Errorf("kafka client is closed")
+		}
+
+		coordinator, err := client.Coordinator(group)
+		if err != nil {
+			return err
+		}
+
+		response, err := coordinator.DescribeGroups(&sarama.DescribeGroupsRequest{Groups: []string{group}})
+		if err != nil {
+			return err
+		}
+		if len(response.Groups) == 0 {
+			return fmt.Errorf("consumer group %s not found", group)
+		}
+
+		description := response.Groups[0]
+		if description.Err != sarama.ErrNoError {
+			return description.Err
+		}
+		for _, member := range description.Members {
+			if member.ClientId == clientID {
+				return nil
+			}
+		}
+		return fmt.Errorf("not a member of consumer group %s, which is %s", group, description.State)
+	}
+}
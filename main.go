@@ -1,13 +1,19 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
 
-	"github.com/ONSdigital/dp-csv-splitter/ons_aws"
+	"github.com/ONSdigital/dp-csv-splitter/api"
 	"github.com/ONSdigital/dp-csv-splitter/config"
+	"github.com/ONSdigital/dp-csv-splitter/health"
 	"github.com/ONSdigital/dp-csv-splitter/message"
+	"github.com/ONSdigital/dp-csv-splitter/metrics"
+	"github.com/ONSdigital/dp-csv-splitter/ons_aws"
+	"github.com/ONSdigital/dp-csv-splitter/source"
 	"github.com/ONSdigital/dp-csv-splitter/splitter"
 	"github.com/ONSdigital/go-ns/log"
 	"github.com/Shopify/sarama"
@@ -16,7 +22,10 @@ import (
 )
 
 func main() {
-	config.Load()
+	if err := config.Load(); err != nil {
+		log.Error(err, log.Data{"message": "Invalid configuration."})
+		os.Exit(1)
+	}
 
 	// Trap SIGINT to trigger a graceful shutdown.
 	signals := make(chan os.Signal, 1)
@@ -27,30 +36,92 @@ func main() {
 	kafkaConfig.Producer.RequiredAcks = sarama.WaitForAll
 	kafkaConfig.Producer.Return.Successes = true
 	kafkaConfig.Producer.Return.Errors = true
+	if config.PartitionKey == splitter.KeyRoundRobin {
+		kafkaConfig.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	}
+
+	// Each instance has its own client ID so the health check can find it among the members of the consumer group.
+	kafkaConfig.ClientID = clientID()
+
+	producerClient, err := sarama.NewClient([]string{config.KafkaAddr}, kafkaConfig)
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to create Kafka client."})
+		os.Exit(1)
+	}
 
-	producer, err := sarama.NewSyncProducer([]string{config.KafkaAddr}, kafkaConfig)
+	producer, err := sarama.NewSyncProducerFromClient(producerClient)
 	if err != nil {
 		log.Error(err, log.Data{"message": "Failed to create message producer."})
 	}
 
 	splitter.Producer = producer
-	awsService := ons_aws.NewService()
+	if len(config.CheckpointDir) > 0 {
+		checkpoints, err := splitter.NewFileCheckpointStore(config.CheckpointDir)
+		if err != nil {
+			log.Error(err, log.Data{"message": "Failed to create checkpoint store."})
+			os.Exit(1)
+		}
+		splitter.Checkpoints = checkpoints
+	}
+
+	s3Service, err := ons_aws.NewService()
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to create AWS S3 service."})
+		os.Exit(1)
+	}
+
+	sources := source.NewRegistry()
+	sources.Register(s3Service, "s3")
+	if config.EnableFileSource {
+		sources.Register(source.NewFileSource(), "file")
+	}
+	sources.Register(source.NewHTTPSource(source.NewHTTPClient(config.HTTPSourceTimeout, config.HTTPSourceConnectTimeout)), "http", "https")
 	csvProcessor := splitter.NewCSVProcessor()
 
+	consumerConfig := cluster.NewConfig()
+	consumerConfig.ClientID = kafkaConfig.ClientID
+	consumerClient, err := cluster.NewClient([]string{config.KafkaAddr}, consumerConfig)
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to create Kafka consumer client."})
+		os.Exit(1)
+	}
+
+	consumer, err := cluster.NewConsumerFromClient(consumerClient, config.KafkaConsumerGroup, []string{config.KafkaConsumerTopic})
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to create message consumer."})
+		os.Exit(1)
+	}
+
 	go func() {
 		<-signals
 
+		// Closing the consumer commits the offsets of the messages that have been fully processed.
+		if err := consumer.Close(); err != nil {
+			log.Error(err, log.Data{"message": "Failed to shutdown consumer gracefully."})
+		}
+		consumerClient.Close()
+
 		if err := producer.Close(); err != nil {
 			log.Debug("Failed to shutdown AsyncProducer gracefully.", nil)
 			log.Error(err, nil)
 			os.Exit(1)
 		}
+		producerClient.Close()
 		log.Debug("Graceful shutdown of AsyncProducer was successful.", nil)
 		os.Exit(0)
 	}()
 
-	// For now this is redundant but in future we will be adding a health check endpoint.
 	router := pat.New()
+	router.Get("/healthcheck", health.Handler(config.HealthcheckTimeout,
+		health.Check{Name: "kafka producer", Check: health.KafkaProducerCheck(producerClient, config.RowTopicName, config.DatasetTopicName)},
+		health.Check{Name: "kafka consumer group", Check: health.ConsumerGroupCheck(consumerClient, config.KafkaConsumerGroup, consumerConfig.ClientID)},
+		health.Check{Name: "s3", Check: s3Service.Healthcheck},
+	))
+	router.Get("/metrics", metrics.Handler(metrics.Registry))
+	router.Post("/split", api.SplitHandler(sources, csvProcessor))
+	router.Get("/datasets/{id}/events", api.DatasetEventsHandler(splitter.Jobs))
+	router.Get("/datasets/{id}", api.DatasetHandler(splitter.Jobs))
+	router.Get("/datasets", api.DatasetsHandler(splitter.Jobs))
 
 	go func() {
 		if err := http.ListenAndServe(config.BindAddr, router); err != nil {
@@ -59,7 +130,21 @@ func main() {
 		}
 	}()
 
-	consumerConfig := cluster.NewConfig()
-	consumer, err := cluster.NewConsumer([]string{config.KafkaAddr}, config.KafkaConsumerGroup, []string{config.KafkaConsumerTopic}, consumerConfig)
-	message.ConsumerLoop(consumer, awsService, csvProcessor)
+	if err := message.ConsumerLoop(consumer, sources, csvProcessor); err != nil {
+		// Leave the failed message unmarked so it is consumed again when the service restarts.
+		log.Error(err, log.Data{"message": "Consumer loop stopped."})
+		consumer.Close()
+		consumerClient.Close()
+		producer.Close()
+		producerClient.Close()
+		os.Exit(1)
+	}
+}
+
+var invalidClientIDChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// clientID returns a Kafka client ID unique to this instance of the service, made from its host name and process ID.
+func clientID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("dp-csv-splitter-%s-%d", invalidClientIDChars.ReplaceAllString(hostname, "-"), os.Getpid())
 }
@@ -0,0 +1,130 @@
+package message
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/source"
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+func isArchive(url *url.URL) bool {
+	return strings.EqualFold(path.Ext(url.Path), ".zip")
+}
+
+// processArchive splits each CSV file in a zip archive as its own dataset. If a file fails the remaining files are
+// still split and the error is returned, so the message is retried. Each file that was split is recorded as complete
+// in the checkpoint store so the retry skips it, and the records are deleted once every file has been split.
+func processArchive(uploadEvent *event.FileUploaded, sources source.Source, csvProcessor splitter.CSVProcessor) error {
+	archive, err := sources.Open(uploadEvent.S3URL.URL, 0)
+	if err != nil {
+		log.Error(err, log.Data{"message": "Error while attempting to get the archive from its source."})
+		return err
+	}
+	defer archive.Close()
+
+	// archive/zip needs random access to read the archive's directory, so copy it to a temporary file first.
+	tmpFile, size, err := downloadToTempFile(archive)
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to download archive."})
+		return err
+	}
+	defer removeTempFile(tmpFile)
+
+	zipReader, err := zip.NewReader(tmpFile, size)
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to read zip archive."})
+		return err
+	}
+
+	var splitErr error
+	var members = 0
+	for _, member := range zipReader.File {
+		if !strings.EqualFold(path.Ext(member.Name), ".csv") {
+			continue
+		}
+		if len(uploadEvent.ArchiveMember) > 0 && member.Name != uploadEvent.ArchiveMember {
+			continue
+		}
+
+		memberEvent := *uploadEvent
+		memberEvent.ArchiveMember = member.Name
+		members++
+
+		log.Debug("Processing archive member", log.Data{"url": memberEvent.GetURL(), "member": member.Name})
+		if err := processArchiveMember(&memberEvent, member, archive.Version, csvProcessor); err != nil {
+			splitErr = err
+		}
+	}
+
+	if members == 0 {
+		log.Debug("No CSV files to split in archive", log.Data{"url": uploadEvent.GetURL(), "member": uploadEvent.ArchiveMember})
+	}
+	if splitErr == nil {
+		if err := splitter.Checkpoints.DeleteAll(uploadEvent.GetSourceURL()); err != nil {
+			log.Error(err, log.Data{"message": "Failed to delete the completed archive members."})
+		}
+	}
+	return splitErr
+}
+
+// downloadToTempFile copies r to a new temporary file, returning the file and its size. The caller is responsible for
+// removing the file with removeTempFile.
+func downloadToTempFile(r io.Reader) (*os.File, int64, error) {
+	tmpFile, err := ioutil.TempFile("", "dp-csv-splitter-")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(tmpFile, r)
+	if err != nil {
+		removeTempFile(tmpFile)
+		return nil, 0, err
+	}
+	return tmpFile, size, nil
+}
+
+func removeTempFile(tmpFile *os.File) {
+	tmpFile.Close()
+	os.Remove(tmpFile.Name())
+}
+
+func processArchiveMember(memberEvent *event.FileUploaded, member *zip.File, version string, csvProcessor splitter.CSVProcessor) error {
+	r, err := member.Open()
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to open archive member."})
+		return err
+	}
+	defer r.Close()
+
+	checkpoint := getCheckpoint(memberEvent, version)
+	if checkpoint != nil && checkpoint.Complete {
+		log.Debug("Skipping archive member that has already been split", log.Data{"url": memberEvent.GetSourceURL()})
+		return nil
+	}
+
+	// Archive members can only be read from their start, so skip to the checkpoint.
+	if checkpoint != nil {
+		if _, err := io.CopyN(ioutil.Discard, r, checkpoint.Offset); err != nil {
+			log.Error(err, log.Data{"message": "Failed to skip to checkpoint in archive member."})
+			return err
+		}
+	}
+
+	if err := split(r, memberEvent, version, "", checkpoint, csvProcessor); err != nil {
+		return err
+	}
+
+	complete := &splitter.Checkpoint{DatasetID: memberEvent.DatasetID, URL: memberEvent.GetSourceURL(), Version: version, Complete: true}
+	if err := splitter.Checkpoints.Save(complete); err != nil {
+		log.Error(err, log.Data{"message": "Failed to record that the archive member has been split."})
+	}
+	return nil
+}
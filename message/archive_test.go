@@ -0,0 +1,107 @@
+package message
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/source"
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type archiveSource struct {
+	content []byte
+}
+
+func (s *archiveSource) Open(url *url.URL, offset int64) (*source.File, error) {
+	return &source.File{ReadCloser: ioutil.NopCloser(bytes.NewReader(s.content)), Version: "\"etag\""}, nil
+}
+
+type recordingProcessor struct {
+	members []string
+	rows    []string
+	// failures the archive members to fail the split of, once each.
+	failures map[string]bool
+}
+
+func (p *recordingProcessor) Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string, version string) error {
+	if p.failures[event.ArchiveMember] {
+		delete(p.failures, event.ArchiveMember)
+		return errors.New("broker unavailable")
+	}
+	b, _ := ioutil.ReadAll(r)
+	p.members = append(p.members, event.ArchiveMember)
+	p.rows = append(p.rows, string(b))
+	return nil
+}
+
+func (p *recordingProcessor) Resume(r io.Reader, event *event.FileUploaded, startTime time.Time, checkpoint *splitter.Checkpoint) error {
+	return p.Process(r, event, startTime, checkpoint.DatasetID, checkpoint.Version)
+}
+
+func TestProcessArchive(t *testing.T) {
+
+	Convey("Given a zip archive containing two CSV files and a readme", t, func() {
+		var archive bytes.Buffer
+		writer := zip.NewWriter(&archive)
+		for name, content := range map[string]string{"a.csv": "header\na\n", "b.csv": "header\nb\n", "README.txt": "readme"} {
+			w, _ := writer.Create(name)
+			w.Write([]byte(content))
+		}
+		writer.Close()
+
+		s3URL, _ := url.Parse("s3://bucket/dir/tables.zip")
+		uploadEvent := &event.FileUploaded{S3URL: event.NewS3URL(s3URL), Time: time.Now().UTC().Unix()}
+		processor := &recordingProcessor{}
+
+		Convey("When the archive is processed", func() {
+			err := processArchive(uploadEvent, &archiveSource{content: archive.Bytes()}, processor)
+
+			Convey("Then each CSV file is split as its own dataset", func() {
+				So(err, ShouldBeNil)
+				So(processor.members, ShouldContain, "a.csv")
+				So(processor.members, ShouldContain, "b.csv")
+				So(len(processor.members), ShouldEqual, 2)
+				So(processor.rows, ShouldContain, "header\na\n")
+			})
+		})
+
+		Convey("When one of the CSV files fails to split and the archive is retried", func() {
+			store := memoryCheckpoints{}
+			splitter.Checkpoints = store
+			Reset(func() { splitter.Checkpoints = defaultCheckpoints })
+			processor.failures = map[string]bool{"b.csv": true}
+
+			err := processArchive(uploadEvent, &archiveSource{content: archive.Bytes()}, processor)
+			So(err, ShouldNotBeNil)
+			So(processor.members, ShouldResemble, []string{"a.csv"})
+			retryErr := processArchive(uploadEvent, &archiveSource{content: archive.Bytes()}, processor)
+
+			Convey("Then only the file that failed is split again", func() {
+				So(retryErr, ShouldBeNil)
+				So(processor.members, ShouldResemble, []string{"a.csv", "b.csv"})
+			})
+
+			Convey("Then the record of the completed files is deleted once every file has been split", func() {
+				So(store, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the event names a single archive member", func() {
+			uploadEvent.ArchiveMember = "b.csv"
+			err := processArchive(uploadEvent, &archiveSource{content: archive.Bytes()}, processor)
+
+			Convey("Then only that file is split", func() {
+				So(err, ShouldBeNil)
+				So(processor.members, ShouldResemble, []string{"b.csv"})
+			})
+		})
+	})
+}
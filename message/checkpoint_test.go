@@ -0,0 +1,118 @@
+package message
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/source"
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type memoryCheckpoints map[string]*splitter.Checkpoint
+
+func (store memoryCheckpoints) Get(url string) (*splitter.Checkpoint, error) { return store[url], nil }
+func (store memoryCheckpoints) Save(checkpoint *splitter.Checkpoint) error {
+	store[checkpoint.URL] = checkpoint
+	return nil
+}
+func (store memoryCheckpoints) Delete(url string) error {
+	delete(store, url)
+	return nil
+}
+func (store memoryCheckpoints) DeleteAll(url string) error {
+	for checkpointURL := range store {
+		if checkpointURL == url || strings.HasPrefix(checkpointURL, url+"#") {
+			delete(store, checkpointURL)
+		}
+	}
+	return nil
+}
+
+type versionedSource struct {
+	version string
+	offsets []int64
+}
+
+func (s *versionedSource) Open(url *url.URL, offset int64) (*source.File, error) {
+	s.offsets = append(s.offsets, offset)
+	return &source.File{ReadCloser: ioutil.NopCloser(strings.NewReader("header\nrow\n")), Version: s.version}, nil
+}
+
+type resumingProcessor struct {
+	datasetID string
+	version   string
+	resumed   bool
+}
+
+func (p *resumingProcessor) Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string, version string) error {
+	p.datasetID, p.version = datasetID, version
+	return nil
+}
+
+func (p *resumingProcessor) Resume(r io.Reader, event *event.FileUploaded, startTime time.Time, checkpoint *splitter.Checkpoint) error {
+	p.datasetID, p.version, p.resumed = checkpoint.DatasetID, checkpoint.Version, true
+	return nil
+}
+
+func TestProcessEvent_Checkpoints(t *testing.T) {
+	s3URL, _ := url.Parse("s3://bucket/dir/test.csv")
+	uploadEvent := &event.FileUploaded{S3URL: event.NewS3URL(s3URL), Time: time.Now().UTC().Unix()}
+
+	Convey("Given a checkpoint of an interrupted split", t, func() {
+		store := memoryCheckpoints{}
+		store.Save(&splitter.Checkpoint{DatasetID: "old-dataset", URL: s3URL.String(), Version: "v1", Index: 10, Offset: 100})
+		defaultJobs := splitter.Jobs
+		splitter.Checkpoints, splitter.Jobs = store, splitter.NewJobRegistry()
+		Reset(func() { splitter.Checkpoints, splitter.Jobs = defaultCheckpoints, defaultJobs })
+		processor := &resumingProcessor{}
+
+		Convey("When the same version of the file is processed", func() {
+			sources := &versionedSource{version: "v1"}
+			So(ProcessEvent(uploadEvent, sources, processor), ShouldBeNil)
+
+			Convey("Then the split is resumed from the checkpoint", func() {
+				So(processor.resumed, ShouldBeTrue)
+				So(processor.datasetID, ShouldEqual, "old-dataset")
+				So(sources.offsets, ShouldResemble, []int64{100})
+			})
+		})
+
+		Convey("When a different version of the file is processed", func() {
+			sources := &versionedSource{version: "v2"}
+			So(ProcessEvent(uploadEvent, sources, processor), ShouldBeNil)
+
+			Convey("Then the checkpoint is deleted and the new file is split from its start", func() {
+				So(processor.resumed, ShouldBeFalse)
+				So(processor.datasetID, ShouldNotEqual, "old-dataset")
+				So(processor.version, ShouldEqual, "v2")
+				So(sources.offsets, ShouldResemble, []int64{100, 0})
+				So(store, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the message for the file is parked", func() {
+			mockProducer := mocks.NewSyncProducer(t, nil)
+			mockProducer.ExpectSendMessageAndSucceed()
+			splitter.Producer = mockProducer
+			value, _ := json.Marshal(uploadEvent)
+
+			So(parkMessage(&sarama.ConsumerMessage{Value: value}, io.ErrUnexpectedEOF), ShouldBeNil)
+			mockProducer.Close()
+
+			Convey("Then its checkpoint is deleted", func() {
+				So(store, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+var defaultCheckpoints = splitter.Checkpoints
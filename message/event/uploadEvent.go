@@ -1,9 +1,13 @@
 package event
 
 import (
+	"fmt"
 	"net/url"
+	"path"
+	"regexp"
 	"strings"
 
+	"github.com/ONSdigital/dp-csv-splitter/config"
 	"github.com/ONSdigital/go-ns/log"
 )
 
@@ -11,6 +15,85 @@ import (
 type FileUploaded struct {
 	Time  int64
 	S3URL *S3URLType
+	// ArchiveMember the name of the CSV file to split from a zip archive. Every CSV file is split when empty.
+	ArchiveMember string `json:",omitempty"`
+	// Sheet the name, or 1-based position, of the sheet to split from an xlsx workbook. The first sheet when empty.
+	Sheet string `json:",omitempty"`
+	// Encoding the character encoding of the file, such as windows-1252 or utf-16le. Detected when empty.
+	Encoding string `json:",omitempty"`
+	// Delimiter the field delimiter, either the character or one of comma, tab, semicolon or pipe. Sniffed when empty.
+	Delimiter string `json:",omitempty"`
+	// Quote the character used to quote fields, a double or single quote. Sniffed when empty.
+	Quote string `json:",omitempty"`
+	// DatasetID the ID of the dataset to split the file into. Generated from the file when empty.
+	DatasetID string `json:",omitempty"`
+	// Topic the Kafka topic to send the row messages to, in place of the configured row topic when set.
+	Topic string `json:",omitempty"`
+	// BatchSize the number of rows to send to Kafka in a single batch, in place of the configured batch size when set.
+	BatchSize int `json:",omitempty"`
+}
+
+// ValidationError is returned by Validate for an event that cannot be processed.
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid FileUploaded event: " + e.Reason
+}
+
+// The URL schemes of the sources files can be split from.
+var schemes = map[string]bool{"s3": true, "file": true, "http": true, "https": true}
+
+// topicName matches the names Kafka allows for a topic.
+var topicName = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// Validate checks the event has a timestamp and a URL that a file can be read from: an s3 URL must have a bucket and
+// the key of an object, an http URL a host, and a file URL a path. Any topic must be a valid Kafka topic name and any
+// batch size must be positive and no more than config.MaxBatchSize. A dataset ID names a single dataset, so with a zip archive it needs an archive member.
+func (d *FileUploaded) Validate() error {
+	if d.Time <= 0 {
+		return &ValidationError{Reason: "missing or invalid Time"}
+	}
+	if d.S3URL == nil || d.S3URL.URL == nil {
+		return &ValidationError{Reason: "missing S3URL"}
+	}
+	if len(d.Topic) > 0 && !topicName.MatchString(d.Topic) {
+		return &ValidationError{Reason: fmt.Sprintf("invalid Topic %q", d.Topic)}
+	}
+	if d.BatchSize < 0 {
+		return &ValidationError{Reason: "BatchSize must be positive"}
+	}
+	if d.BatchSize > config.MaxBatchSize {
+		return &ValidationError{Reason: fmt.Sprintf("BatchSize must be no more than %d", config.MaxBatchSize)}
+	}
+	if len(d.DatasetID) > 0 && len(d.ArchiveMember) == 0 && strings.EqualFold(path.Ext(d.S3URL.URL.Path), ".zip") {
+		return &ValidationError{Reason: "DatasetID of a zip archive requires an ArchiveMember"}
+	}
+
+	u := d.S3URL.URL
+	if !schemes[u.Scheme] {
+		return &ValidationError{Reason: fmt.Sprintf("unsupported URL scheme %q", u.Scheme)}
+	}
+
+	switch u.Scheme {
+	case "s3":
+		if len(d.GetBucketName()) == 0 {
+			return &ValidationError{Reason: "missing bucket in S3URL"}
+		}
+		if key := d.GetFilePath(); len(key) == 0 || strings.HasSuffix(key, "/") {
+			return &ValidationError{Reason: "missing object key in S3URL"}
+		}
+	case "http", "https":
+		if len(u.Host) == 0 {
+			return &ValidationError{Reason: "missing host in S3URL"}
+		}
+	case "file":
+		if len(u.Path) == 0 || strings.HasSuffix(u.Path, "/") {
+			return &ValidationError{Reason: "missing file path in S3URL"}
+		}
+	}
+	return nil
 }
 
 type S3URLType struct {
@@ -55,3 +138,16 @@ func (d *FileUploaded) GetFilePath() string {
 func (d *FileUploaded) GetURL() string {
 	return d.S3URL.URL.String()
 }
+
+// GetSourceURL returns the URL of the data being split, with the archive member or workbook sheet appended as a
+// fragment when set.
+func (d *FileUploaded) GetSourceURL() string {
+	switch {
+	case len(d.ArchiveMember) > 0:
+		return d.GetURL() + "#" + d.ArchiveMember
+	case len(d.Sheet) > 0:
+		return d.GetURL() + "#" + d.Sheet
+	default:
+		return d.GetURL()
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ONSdigital/dp-csv-splitter/config"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -70,6 +71,71 @@ func TestFileUploaded_GetFilePath(t *testing.T) {
 	})
 }
 
+func TestFileUploaded_GetSourceURL(t *testing.T) {
+	Convey("Given a FileUploaded event for an archive member.", t, func() {
+		s3URL, _ := url.Parse("s3://" + bucketName + "/dir1/tables.zip")
+
+		input := &FileUploaded{
+			S3URL:         NewS3URL(s3URL),
+			Time:          time.Now().UTC().Unix(),
+			ArchiveMember: "table1.csv",
+		}
+
+		Convey("When GetSourceURL is called", func() {
+			result := input.GetSourceURL()
+
+			Convey("Then the member is appended to the URL.", func() {
+				So(result, ShouldEqual, "s3://"+bucketName+"/dir1/tables.zip#table1.csv")
+			})
+		})
+	})
+}
+
+func TestFileUploaded_Validate(t *testing.T) {
+	newEvent := func(rawURL string) *FileUploaded {
+		u, _ := url.Parse(rawURL)
+		return &FileUploaded{S3URL: NewS3URL(u), Time: time.Now().UTC().Unix()}
+	}
+
+	Convey("Given a valid FileUploaded event.", t, func() {
+		Convey("Then it passes validation.", func() {
+			So(newEvent("s3://"+bucketName+filePath).Validate(), ShouldBeNil)
+			So(newEvent("https://example.com/test-file.csv").Validate(), ShouldBeNil)
+			So(newEvent("file:///tmp/test-file.csv").Validate(), ShouldBeNil)
+		})
+	})
+
+	Convey("Given invalid FileUploaded events.", t, func() {
+		noTime := newEvent("s3://" + bucketName + filePath)
+		noTime.Time = 0
+
+		Convey("Then each fails validation.", func() {
+			So(noTime.Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+			So((&FileUploaded{Time: 1}).Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+			So(newEvent("ftp://"+bucketName+filePath).Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+			So(newEvent("s3:///dir1/test-file.csv").Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+			So(newEvent("s3://"+bucketName+"/dir1/").Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+			So(newEvent("http:///test-file.csv").Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+
+			badTopic := newEvent("s3://" + bucketName + filePath)
+			badTopic.Topic = "rows/2017"
+			So(badTopic.Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+
+			badBatchSize := newEvent("s3://" + bucketName + filePath)
+			badBatchSize.BatchSize = -1
+			So(badBatchSize.Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+			badBatchSize.BatchSize = config.MaxBatchSize + 1
+			So(badBatchSize.Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+
+			wholeArchive := newEvent("s3://" + bucketName + "/dir1/archive.zip")
+			wholeArchive.DatasetID = "dataset"
+			So(wholeArchive.Validate(), ShouldHaveSameTypeAs, &ValidationError{})
+			wholeArchive.ArchiveMember = "test-file.csv"
+			So(wholeArchive.Validate(), ShouldBeNil)
+		})
+	})
+}
+
 func TestS3URLType_UnmarshalJSON(t *testing.T) {
 	Convey("Given a valid S3URLType JSON", t, func() {
 		s3URL, _ := url.Parse("s3://" + bucketName + filePath)
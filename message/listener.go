@@ -2,45 +2,330 @@ package message
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"time"
 
-	"github.com/ONSdigital/dp-csv-splitter/ons_aws"
+	"github.com/ONSdigital/dp-csv-splitter/config"
 	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/metrics"
+	"github.com/ONSdigital/dp-csv-splitter/source"
 	"github.com/ONSdigital/dp-csv-splitter/splitter"
 	"github.com/ONSdigital/go-ns/log"
 	"github.com/Shopify/sarama"
-	"github.com/satori/go.uuid"
 )
 
-func ConsumerLoop(listener Listener, awsService ons_aws.AWSService, processor splitter.CSVProcessor) {
+// ConsumerLoop processes each message from the listener. A message's offset is only marked once it has been fully
+// processed, parked after its retries are exhausted, or sent to the dead letter topic if it is not a valid event, so a
+// restart part way through a split consumes it again. An error is returned if a failed message could not be parked or
+// dead lettered, in which case its offset is left unmarked.
+func ConsumerLoop(listener Listener, sources source.Source, processor splitter.CSVProcessor) error {
 	for message := range listener.Messages() {
 		log.Debug("Message received from Kafka!", nil)
-		processMessage(message, awsService, processor)
+		metrics.EventsConsumed.Inc(1)
+		if err := processWithRetry(message, sources, processor); err != nil {
+			if _, ok := err.(*invalidEventError); ok {
+				err = deadLetterMessage(message, err)
+			} else {
+				err = parkMessage(message, err)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		listener.MarkOffset(message, "")
 	}
+	return nil
+}
+
+// processWithRetry processes the message, retrying up to config.MaxRetries times if it fails. An invalid event is
+// not retried as it can never succeed.
+func processWithRetry(message *sarama.ConsumerMessage, sources source.Source, processor splitter.CSVProcessor) error {
+	var err error
+	for attempt := 0; attempt <= config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(config.RetryInterval)
+		}
+		if err = processMessage(message, sources, processor); err == nil {
+			return nil
+		}
+		log.Error(err, log.Data{
+			"details":   "Failed to process message",
+			"topic":     message.Topic,
+			"partition": message.Partition,
+			"offset":    message.Offset,
+			"attempt":   attempt + 1,
+		})
+		if _, ok := err.(*invalidEventError); ok {
+			return err
+		}
+	}
+	return err
+}
+
+// parkMessage sends the original message to the parked topic so it can be replayed once the cause is fixed. The
+// checkpoints of the event's file are deleted, so a replay, or a later upload to the same URL, starts from the
+// beginning rather than resuming the abandoned split.
+func parkMessage(message *sarama.ConsumerMessage, cause error) error {
+	log.Error(cause, log.Data{
+		"details":   "Retries exhausted, parking message",
+		"topic":     message.Topic,
+		"partition": message.Partition,
+		"offset":    message.Offset,
+	})
+
+	var parked event.FileUploaded
+	if err := json.Unmarshal(message.Value, &parked); err == nil && parked.S3URL != nil && parked.S3URL.URL != nil {
+		if err := splitter.Checkpoints.DeleteAll(parked.GetSourceURL()); err != nil {
+			log.Error(err, log.Data{"details": "Failed to delete checkpoints of parked message"})
+		}
+	}
+
+	producerMsg := &sarama.ProducerMessage{
+		Topic: config.ParkedTopicName,
+		Value: sarama.ByteEncoder(message.Value),
+	}
+	if message.Key != nil {
+		producerMsg.Key = sarama.ByteEncoder(message.Key)
+	}
+
+	if _, _, err := splitter.Producer.SendMessage(producerMsg); err != nil {
+		log.Error(err, log.Data{"details": "Failed to park message"})
+		return err
+	}
+	return nil
 }
 
-func processMessage(message *sarama.ConsumerMessage, awsService ons_aws.AWSService, csvProcessor splitter.CSVProcessor) error {
+// invalidEventError is returned for a message that is not a valid FileUploaded event.
+type invalidEventError struct {
+	err error
+}
+
+func (e *invalidEventError) Error() string {
+	return e.err.Error()
+}
+
+// DeadLetterEvent is sent to the event dead letter topic for each message that is not a valid FileUploaded event.
+type DeadLetterEvent struct {
+	// Payload the original value of the message.
+	Payload   []byte `json:"payload"`
+	Reason    string `json:"reason"`
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
 
+// deadLetterMessage sends an invalid event to the dead letter topic along with the reason it is invalid.
+func deadLetterMessage(message *sarama.ConsumerMessage, cause error) error {
+	log.Error(cause, log.Data{
+		"details":   "Invalid event, sending message to the dead letter topic",
+		"topic":     message.Topic,
+		"partition": message.Partition,
+		"offset":    message.Offset,
+	})
+
+	deadLetterJSON, err := json.Marshal(DeadLetterEvent{
+		Payload:   message.Value,
+		Reason:    cause.Error(),
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+	})
+	if err != nil {
+		return err
+	}
+
+	producerMsg := &sarama.ProducerMessage{
+		Topic: config.EventDeadLetterTopicName,
+		Value: sarama.ByteEncoder(deadLetterJSON),
+	}
+	if message.Key != nil {
+		producerMsg.Key = sarama.ByteEncoder(message.Key)
+	}
+
+	if _, _, err := splitter.Producer.SendMessage(producerMsg); err != nil {
+		log.Error(err, log.Data{"details": "Failed to send message to the dead letter topic"})
+		return err
+	}
+	return nil
+}
+
+// processMessage splits the file of a FileUploaded event.
+func processMessage(message *sarama.ConsumerMessage, sources source.Source, csvProcessor splitter.CSVProcessor) error {
 	var event event.FileUploaded
 	if err := json.Unmarshal(message.Value, &event); err != nil {
-		log.Error(err, nil)
-		return err
+		return &invalidEventError{err: err}
+	}
+	if err := event.Validate(); err != nil {
+		return &invalidEventError{err: err}
 	}
+	return ProcessEvent(&event, sources, csvProcessor)
+}
+
+// ProcessEvent splits the file of a valid FileUploaded event, whether it was consumed from Kafka or requested through
+// the API. A panic is recovered and returned as an error so a bad event can never stop the consumer.
+func ProcessEvent(event *event.FileUploaded, sources source.Source, csvProcessor splitter.CSVProcessor) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing message: %v", r)
+		}
+	}()
 
 	log.Debug("Processing uploadEvent message", log.Data{"url": event.GetURL()})
 
-	awsReadCloser, err := awsService.GetCSV(&event)
-	defer awsReadCloser.Close()
+	if isArchive(event.S3URL.URL) {
+		return processArchive(event, sources, csvProcessor)
+	}
+	if isWorkbook(event.S3URL.URL) {
+		return processWorkbook(event, sources, csvProcessor)
+	}
+
+	// The version of the file is only known once it is opened, at the checkpoint's offset.
+	checkpoint := readCheckpoint(event)
+	var offset int64
+	if checkpoint != nil {
+		offset = checkpoint.Offset
+	}
+	datasetID, err := queueJob(event, checkpoint)
+	if err != nil {
+		return err
+	}
+
+	csvFile, err := sources.Open(event.S3URL.URL, offset)
 	if err != nil {
-		log.Error(err, log.Data{"message": "Error while attempting get to get from from AWS s3 bucket."})
+		log.Error(err, log.Data{"message": "Error while attempting to get the file from its source."})
+		failJob(datasetID, err)
 		return err
 	}
+	if checkpoint != nil && checkpoint.Version != csvFile.Version {
+		// A different file has been uploaded since the checkpoint was saved, so split it from its start.
+		checkpoint = checkCheckpointVersion(event, checkpoint, csvFile.Version)
+		datasetID = discardJob(event, datasetID)
+		csvFile.Close()
+		if csvFile, err = sources.Open(event.S3URL.URL, 0); err != nil {
+			log.Error(err, log.Data{"message": "Error while attempting to get the file from its source."})
+			failJob(datasetID, err)
+			return err
+		}
+	}
+	defer csvFile.Close()
+
+	return split(csvFile, event, csvFile.Version, datasetID, checkpoint, csvProcessor)
+}
+
+// errFileChanged is recorded as the failure of the job of an interrupted split that is not resumed, as a different
+// version of its file has been uploaded since.
+var errFileChanged = errors.New("a different version of the file has been uploaded since the split was interrupted")
+
+// queueJob queues the job of the split of the event's file in splitter.Jobs before the file is opened, so a file that
+// cannot be opened is reported as a failed job. It returns the ID of the dataset the file is split into, which is
+// the checkpoint's when the split is resumed, or an empty string without queuing a job if the ID can only be derived
+// once the version of the file is known. splitter.ErrJobInProgress is returned if the dataset is already being split.
+func queueJob(event *event.FileUploaded, checkpoint *splitter.Checkpoint) (string, error) {
+	var datasetID string
+	switch {
+	case checkpoint != nil:
+		datasetID = checkpoint.DatasetID
+	case len(event.DatasetID) > 0:
+		datasetID = event.DatasetID
+	case !config.DeterministicIDs:
+		// A random ID does not depend on the version of the file.
+		datasetID = splitter.NewDatasetID(event.GetSourceURL(), "")
+	default:
+		return "", nil
+	}
+
+	if !splitter.Jobs.Queue(datasetID, event.GetSourceURL()) {
+		return "", splitter.ErrJobInProgress
+	}
+	return datasetID, nil
+}
+
+// failJob records that the file of the queued job could not be read. Nothing is recorded if no job was queued.
+func failJob(datasetID string, err error) {
+	if len(datasetID) > 0 {
+		splitter.Jobs.Fail(datasetID, err)
+	}
+}
+
+// discardJob fails the job queued to resume the split of a file that has since changed, unless the event names the
+// dataset, returning the ID of the dataset to split the changed file into: the event's, or an empty string to derive
+// a new one.
+func discardJob(event *event.FileUploaded, datasetID string) string {
+	if datasetID == event.DatasetID {
+		return datasetID
+	}
+	failJob(datasetID, errFileChanged)
+	return ""
+}
 
-	datasetId := uuid.NewV4().String()
-	csvProcessor.Process(awsReadCloser, &event, time.Now(), datasetId)
+// getCheckpoint returns the checkpoint of an interrupted split of the given version of the event's file, or nil to
+// start from the beginning.
+func getCheckpoint(event *event.FileUploaded, version string) *splitter.Checkpoint {
+	if checkpoint := readCheckpoint(event); checkpoint != nil {
+		return checkCheckpointVersion(event, checkpoint, version)
+	}
 	return nil
 }
 
+// readCheckpoint returns the checkpoint of an interrupted split of the event's file, whatever its version, or nil if
+// there is none. A checkpoint of a different dataset than the one the event asks for is ignored.
+func readCheckpoint(event *event.FileUploaded) *splitter.Checkpoint {
+	checkpoint, err := splitter.Checkpoints.Get(event.GetSourceURL())
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to read checkpoint, starting split from the beginning."})
+		return nil
+	}
+	if checkpoint != nil && len(event.DatasetID) > 0 && checkpoint.DatasetID != event.DatasetID {
+		return nil
+	}
+	return checkpoint
+}
+
+// checkCheckpointVersion returns the checkpoint if it was saved for the given version of the file. Otherwise the file
+// has changed, so its offset, header and dialect no longer apply: the checkpoint is deleted and nil is returned.
+func checkCheckpointVersion(event *event.FileUploaded, checkpoint *splitter.Checkpoint, version string) *splitter.Checkpoint {
+	if checkpoint.Version == version {
+		return checkpoint
+	}
+
+	log.Debug("Discarding checkpoint of a different version of the file", log.Data{
+		"url":               checkpoint.URL,
+		"checkpointVersion": checkpoint.Version,
+		"version":           version,
+	})
+	if err := splitter.Checkpoints.Delete(checkpoint.URL); err != nil {
+		log.Error(err, log.Data{"message": "Failed to delete checkpoint of a different version of the file."})
+	}
+	return nil
+}
+
+// split processes the CSV read from r as a new dataset, or resumes the checkpointed dataset in which case r must
+// already be at the checkpoint's offset. datasetID is the ID of the dataset whose job was queued before the file was
+// opened, or an empty string to derive the ID, and queue its job, now that the version of the file is known.
+func split(r io.Reader, event *event.FileUploaded, version string, datasetID string, checkpoint *splitter.Checkpoint, csvProcessor splitter.CSVProcessor) error {
+	if len(datasetID) == 0 {
+		switch {
+		case checkpoint != nil:
+			datasetID = checkpoint.DatasetID
+		case len(event.DatasetID) > 0:
+			datasetID = event.DatasetID
+		default:
+			datasetID = splitter.NewDatasetID(event.GetSourceURL(), version)
+		}
+		if !splitter.Jobs.Queue(datasetID, event.GetSourceURL()) {
+			return splitter.ErrJobInProgress
+		}
+	}
+
+	if checkpoint != nil {
+		return csvProcessor.Resume(r, event, time.Now(), checkpoint)
+	}
+	return csvProcessor.Process(r, event, time.Now(), datasetID, version)
+}
+
 type Listener interface {
 	Messages() <-chan *sarama.ConsumerMessage
+	MarkOffset(msg *sarama.ConsumerMessage, metadata string)
 }
@@ -2,23 +2,26 @@ package message_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/ONSdigital/dp-csv-splitter/config"
 	"github.com/ONSdigital/dp-csv-splitter/message"
 	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/source"
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
 	"github.com/Shopify/sarama"
 	"github.com/Shopify/sarama/mocks"
 	. "github.com/smartystreets/goconvey/convey"
 	"io/ioutil"
 )
 
-var messagesProcessed = 0
-
 func TestProcessor(t *testing.T) {
 	s3URL, _ := url.Parse("s3://bucket/dir/test.csv")
 	event := &event.FileUploaded{
@@ -34,56 +37,226 @@ func TestProcessor(t *testing.T) {
 	mockListener := newMocklistener(mockConsumer, topicName)
 
 	mockProcessor := &mockProcessor{}
-	mockAwservice := &mockAwsService{}
+	mockSource := &mockSource{}
 
 	Convey("Given a mock consumer", t, func() {
-		messagesProcessed = 0
-		go message.ConsumerLoop(mockListener, mockAwservice, mockProcessor)
-		loop := 0
+		done := runConsumerLoop(mockListener, mockSource, mockProcessor)
 
 		// Give this at least 300 milli-seconds to run before asserting the message was processed
-		for loop < 3 {
-			if messagesProcessed >= 1 {
-				break
-			}
-			time.Sleep(100 * time.Millisecond)
-			loop++
-		}
-		So(messagesProcessed, ShouldEqual, 1)
+		mockListener.waitForMarkedOffsets(1)
 		mockConsumer.Close()
+		<-done
+
+		So(mockProcessor.Invocations(), ShouldEqual, 1)
+		So(mockListener.MarkedOffsets(), ShouldHaveLength, 1)
+	})
+
+}
+
+func TestConsumerLoop_ParksFailedMessages(t *testing.T) {
+	s3URL, _ := url.Parse("s3://bucket/dir/test.csv")
+	messageJson, _ := json.Marshal(&event.FileUploaded{Time: time.Now().UTC().Unix(), S3URL: event.NewS3URL(s3URL)})
+	topicName := "file-uploaded"
+	mockConsumer := mocks.NewConsumer(t, nil)
+	mockConsumer.ExpectConsumePartition(topicName, 0, 0).YieldMessage(&sarama.ConsumerMessage{Value: messageJson})
+	mockListener := newMocklistener(mockConsumer, topicName)
+
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	splitter.Producer = mockProducer
+
+	Convey("Given a message that always fails to process", t, func() {
+		defaultRetryInterval := config.RetryInterval
+		config.RetryInterval = 0
+		mockProducer.ExpectSendMessageAndSucceed()
+		processor := &mockProcessor{err: errors.New("split failed")}
+
+		Convey("When the consumer loop is run", func() {
+			done := runConsumerLoop(mockListener, &mockSource{}, processor)
+			mockListener.waitForMarkedOffsets(1)
+
+			// Stop the loop before restoring the config it reads.
+			mockConsumer.Close()
+			<-done
+			config.RetryInterval = defaultRetryInterval
+
+			Convey("Then the message is retried before being parked and its offset marked", func() {
+				So(processor.Invocations(), ShouldEqual, config.MaxRetries+1)
+				So(mockListener.MarkedOffsets(), ShouldHaveLength, 1)
+			})
+		})
+	})
+
+	mockProducer.Close()
+}
+
+func TestConsumerLoop_DeadLettersInvalidEvents(t *testing.T) {
+	topicName := "file-uploaded"
+	mockConsumer := mocks.NewConsumer(t, nil)
+	partitionConsumer := mockConsumer.ExpectConsumePartition(topicName, 0, 0)
+	partitionConsumer.YieldMessage(&sarama.ConsumerMessage{Value: []byte("not json")})
+	partitionConsumer.YieldMessage(&sarama.ConsumerMessage{Value: []byte(`{"Time":1}`)})
+	mockListener := newMocklistener(mockConsumer, topicName)
+
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	splitter.Producer = mockProducer
+
+	Convey("Given messages that are not valid events", t, func() {
+		// The dead letters are sent from the consumer loop's goroutine, so they are collected through a channel.
+		deadLetters := make(chan message.DeadLetterEvent, 2)
+		for i := 0; i < 2; i++ {
+			mockProducer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+				var deadLetter message.DeadLetterEvent
+				err := json.Unmarshal(value, &deadLetter)
+				deadLetters <- deadLetter
+				return err
+			})
+		}
+		processor := &mockProcessor{}
+
+		Convey("When the consumer loop is run", func() {
+			done := runConsumerLoop(mockListener, &mockSource{}, processor)
+			mockListener.waitForMarkedOffsets(2)
+			mockConsumer.Close()
+			<-done
+			close(deadLetters)
+
+			Convey("Then they are sent to the dead letter topic without being retried", func() {
+				So(processor.Invocations(), ShouldEqual, 0)
+				So(mockListener.MarkedOffsets(), ShouldHaveLength, 2)
+
+				var sent []message.DeadLetterEvent
+				for deadLetter := range deadLetters {
+					sent = append(sent, deadLetter)
+				}
+				So(sent, ShouldHaveLength, 2)
+				So(string(sent[0].Payload), ShouldEqual, "not json")
+				So(sent[1].Reason, ShouldEqual, "invalid FileUploaded event: missing S3URL")
+			})
+		})
 	})
 
+	mockProducer.Close()
+}
+
+func TestProcessEvent_Jobs(t *testing.T) {
+	s3URL, _ := url.Parse("s3://bucket/dir/test.csv")
+	uploadEvent := &event.FileUploaded{Time: time.Now().UTC().Unix(), S3URL: event.NewS3URL(s3URL), DatasetID: "dataset"}
+
+	Convey("Given an event for a dataset", t, func() {
+		defaultJobs := splitter.Jobs
+		splitter.Jobs = splitter.NewJobRegistry()
+		Reset(func() { splitter.Jobs = defaultJobs })
+		processor := &mockProcessor{}
+
+		Convey("When its file cannot be opened", func() {
+			err := message.ProcessEvent(uploadEvent, failingSource{}, processor)
+
+			Convey("Then its job records the error without the file being split", func() {
+				So(err, ShouldNotBeNil)
+				job, ok := splitter.Jobs.Get("dataset")
+				So(ok, ShouldBeTrue)
+				So(job.State, ShouldEqual, splitter.JobFailed)
+				So(job.LastError, ShouldEqual, "file not found")
+				So(processor.Invocations(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the dataset is already being split", func() {
+			splitter.Jobs.Queue("dataset", uploadEvent.GetURL())
+			err := message.ProcessEvent(uploadEvent, &mockSource{}, processor)
+
+			Convey("Then the event is not split again", func() {
+				So(err, ShouldEqual, splitter.ErrJobInProgress)
+				So(processor.Invocations(), ShouldEqual, 0)
+			})
+		})
+	})
 }
 
 var exampleHeaderLine string = "Observation,Data_Marking,Statistical_Unit_Eng,Statistical_Unit_Cym,Measure_Type_Eng,Measure_Type_Cym,Observation_Type,Empty,Obs_Type_Value,Unit_Multiplier,Unit_Of_Measure_Eng,Unit_Of_Measure_Cym,Confidentuality,Empty1,Geographic_Area,Empty2,Empty3,Time_Dim_Item_ID,Time_Dim_Item_Label_Eng,Time_Dim_Item_Label_Cym,Time_Type,Empty4,Statistical_Population_ID,Statistical_Population_Label_Eng,Statistical_Population_Label_Cym,CDID,CDIDDescrip,Empty5,Empty6,Empty7,Empty8,Empty9,Empty10,Empty11,Empty12,Dim_ID_1,dimension_Label_Eng_1,dimension_Label_Cym_1,Dim_Item_ID_1,dimension_Item_Label_Eng_1,dimension_Item_Label_Cym_1,Is_Total_1,Is_Sub_Total_1,Dim_ID_2,dimension_Label_Eng_2,dimension_Label_Cym_2,Dim_Item_ID_2,dimension_Item_Label_Eng_2,dimension_Item_Label_Cym_2,Is_Total_2,Is_Sub_Total_2\n"
 var exampleCsvLine string = "153223,,Person,,Count,,,,,,,,,,K04000001,,,,,,,,,,,,,,,,,,,,,Sex,Sex,,All categories: Sex,All categories: Sex,,,,Age,Age,,All categories: Age 16 and over,All categories: Age 16 and over,,,,Residence Type,Residence Type,,All categories: Residence Type,All categories: Residence Type,,,"
 
-type mockAwsService struct{}
+type mockSource struct{}
 
-func (awsService *mockAwsService) GetCSV(event *event.FileUploaded) (io.ReadCloser, error) {
+func (mock *mockSource) Open(url *url.URL, offset int64) (*source.File, error) {
 	reader := strings.NewReader(exampleHeaderLine + exampleCsvLine)
-	return ioutil.NopCloser(reader), nil
+	return &source.File{ReadCloser: ioutil.NopCloser(reader), Version: "\"etag\""}, nil
 }
 
-type mockProcessor struct{}
+type failingSource struct{}
+
+func (failingSource) Open(url *url.URL, offset int64) (*source.File, error) {
+	return nil, errors.New("file not found")
+}
+
+type mockProcessor struct {
+	err         error
+	mutex       sync.Mutex
+	invocations int
+}
 
-func (processor *mockProcessor) Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string) {
-	messagesProcessed++
+func (processor *mockProcessor) Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string, version string) error {
+	processor.mutex.Lock()
+	defer processor.mutex.Unlock()
+	processor.invocations++
 	fmt.Println("Processor called!")
+	return processor.err
 }
 
-func newMocklistener(consumer *mocks.Consumer, topic string) mockListener {
+// Invocations returns the number of times the processor has been called, which is safe while the consumer loop runs.
+func (processor *mockProcessor) Invocations() int {
+	processor.mutex.Lock()
+	defer processor.mutex.Unlock()
+	return processor.invocations
+}
+
+func (processor *mockProcessor) Resume(r io.Reader, event *event.FileUploaded, startTime time.Time, checkpoint *splitter.Checkpoint) error {
+	return processor.Process(r, event, startTime, checkpoint.DatasetID, checkpoint.Version)
+}
+
+// runConsumerLoop runs the consumer loop in the background, returning a channel that is closed once the loop stops
+// after the consumer is closed.
+func runConsumerLoop(listener message.Listener, sources source.Source, processor splitter.CSVProcessor) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		message.ConsumerLoop(listener, sources, processor)
+	}()
+	return done
+}
+
+func newMocklistener(consumer *mocks.Consumer, topic string) *mockListener {
 	partitionConsumer, _ := consumer.ConsumePartition(topic, 0, 0)
-	return mockListener{
-		messages: partitionConsumer.Messages(),
-	}
+	return &mockListener{messages: partitionConsumer.Messages()}
 }
 
 type mockListener struct {
 	message.Listener
-	messages <-chan *sarama.ConsumerMessage
+	messages      <-chan *sarama.ConsumerMessage
+	mutex         sync.Mutex
+	markedOffsets []int64
 }
 
-func (listener mockListener) Messages() <-chan *sarama.ConsumerMessage {
+func (listener *mockListener) Messages() <-chan *sarama.ConsumerMessage {
 	return listener.messages
 }
+
+func (listener *mockListener) MarkOffset(msg *sarama.ConsumerMessage, metadata string) {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	listener.markedOffsets = append(listener.markedOffsets, msg.Offset)
+}
+
+// MarkedOffsets returns a copy of the offsets marked so far, which is safe while the consumer loop runs.
+func (listener *mockListener) MarkedOffsets() []int64 {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	return append([]int64(nil), listener.markedOffsets...)
+}
+
+// waitForMarkedOffsets waits up to 300 milliseconds for n offsets to be marked.
+func (listener *mockListener) waitForMarkedOffsets(n int) {
+	for loop := 0; loop < 3 && len(listener.MarkedOffsets()) < n; loop++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
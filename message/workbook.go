@@ -0,0 +1,69 @@
+package message
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/source"
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	"github.com/ONSdigital/dp-csv-splitter/xlsx"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+func isWorkbook(url *url.URL) bool {
+	return strings.EqualFold(path.Ext(url.Path), ".xlsx")
+}
+
+// processWorkbook splits a sheet of an xlsx workbook, converting each of its rows into the CSV text of a row message.
+func processWorkbook(uploadEvent *event.FileUploaded, sources source.Source, csvProcessor splitter.CSVProcessor) error {
+	checkpoint := readCheckpoint(uploadEvent)
+	datasetID, err := queueJob(uploadEvent, checkpoint)
+	if err != nil {
+		return err
+	}
+
+	workbook, err := sources.Open(uploadEvent.S3URL.URL, 0)
+	if err != nil {
+		log.Error(err, log.Data{"message": "Error while attempting to get the workbook from its source."})
+		failJob(datasetID, err)
+		return err
+	}
+	defer workbook.Close()
+
+	// A workbook is a zip archive, which needs random access, so copy it to a temporary file first.
+	tmpFile, size, err := downloadToTempFile(workbook)
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to download workbook."})
+		failJob(datasetID, err)
+		return err
+	}
+	defer removeTempFile(tmpFile)
+
+	sheet, err := xlsx.NewSheetReader(tmpFile, size, uploadEvent.Sheet)
+	if err != nil {
+		log.Error(err, log.Data{"message": "Failed to read workbook sheet.", "sheet": uploadEvent.Sheet})
+		failJob(datasetID, err)
+		return err
+	}
+	defer sheet.Close()
+
+	if checkpoint != nil && checkpoint.Version != workbook.Version {
+		checkpoint = checkCheckpointVersion(uploadEvent, checkpoint, workbook.Version)
+		datasetID = discardJob(uploadEvent, datasetID)
+	}
+
+	// The sheet can only be converted from its start, so skip to the checkpoint.
+	if checkpoint != nil {
+		if _, err := io.CopyN(ioutil.Discard, sheet, checkpoint.Offset); err != nil {
+			log.Error(err, log.Data{"message": "Failed to skip to checkpoint in workbook sheet."})
+			failJob(datasetID, err)
+			return err
+		}
+	}
+
+	return split(sheet, uploadEvent, workbook.Version, datasetID, checkpoint, csvProcessor)
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ONSdigital/go-ns/log"
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// The quantiles reported for each timer.
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+// Handler returns a handler that writes the metrics in the registry in the Prometheus text exposition format.
+// go-metrics timers keep a sample of their values rather than counting them into buckets, so they are written as
+// Prometheus summaries with quantiles, in seconds, and a sum only for a Timer.
+func Handler(registry gometrics.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var b bytes.Buffer
+		write(&b, registry)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if _, err := w.Write(b.Bytes()); err != nil {
+			log.Error(err, log.Data{"message": "Failed to write metrics response"})
+		}
+	}
+}
+
+func write(b *bytes.Buffer, registry gometrics.Registry) {
+	metrics := make(map[string]interface{})
+	registry.Each(func(name string, metric interface{}) {
+		metrics[name] = metric
+	})
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if text, ok := help[name]; ok {
+			fmt.Fprintf(b, "# HELP %s %s\n", name, text)
+		}
+
+		switch metric := metrics[name].(type) {
+		case gometrics.Counter:
+			fmt.Fprintf(b, "# TYPE %s counter\n%s %d\n", name, name, metric.Count())
+		case gometrics.Gauge:
+			fmt.Fprintf(b, "# TYPE %s gauge\n%s %d\n", name, name, metric.Value())
+		case *Timer:
+			timer := metric.Snapshot()
+			writeQuantiles(b, name, timer)
+			fmt.Fprintf(b, "%s_sum %s\n", name, formatFloat(metric.Total().Seconds()))
+			fmt.Fprintf(b, "%s_count %d\n", name, timer.Count())
+		case gometrics.Timer:
+			timer := metric.Snapshot()
+			writeQuantiles(b, name, timer)
+			fmt.Fprintf(b, "%s_count %d\n", name, timer.Count())
+		}
+	}
+}
+
+// writeQuantiles writes the type and quantiles of a timer's summary. The sum is only written for a Timer, as it is
+// the only timer that keeps the total of every duration rather than of a sample.
+func writeQuantiles(b *bytes.Buffer, name string, timer gometrics.Timer) {
+	fmt.Fprintf(b, "# TYPE %s summary\n", name)
+	for i, value := range timer.Percentiles(quantiles) {
+		fmt.Fprintf(b, "%s{quantile=\"%s\"} %s\n", name, formatFloat(quantiles[i]), formatFloat(seconds(value)))
+	}
+}
+
+func seconds(nanoseconds float64) float64 {
+	return nanoseconds / float64(time.Second)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
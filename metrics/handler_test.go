@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gometrics "github.com/rcrowley/go-metrics"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHandler(t *testing.T) {
+	Convey("Given a registry with a counter, a gauge and a timer", t, func() {
+		registry := gometrics.NewRegistry()
+		gometrics.NewRegisteredCounter(RowsPublishedName, registry).Inc(3)
+		gometrics.NewRegisteredFunctionalGauge(ActiveSplitsName, registry, func() int64 { return 2 })
+		timer := NewRegisteredTimer(BatchSendLatencyName, registry)
+		timer.Update(time.Second)
+		timer.Update(3 * time.Second)
+
+		Convey("When the metrics are requested", func() {
+			w := httptest.NewRecorder()
+			Handler(registry)(w, httptest.NewRequest("GET", "/metrics", nil))
+
+			Convey("Then each metric is written in the Prometheus text format, sorted by name", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+				So(w.Body.String(), ShouldEqual, strings.Join([]string{
+					"# HELP splitter_active_splits Splits in progress.",
+					"# TYPE splitter_active_splits gauge",
+					"splitter_active_splits 2",
+					"# HELP splitter_batch_send_duration_seconds Time taken to send a batch of rows to Kafka.",
+					"# TYPE splitter_batch_send_duration_seconds summary",
+					`splitter_batch_send_duration_seconds{quantile="0.5"} 2`,
+					`splitter_batch_send_duration_seconds{quantile="0.9"} 3`,
+					`splitter_batch_send_duration_seconds{quantile="0.99"} 3`,
+					"splitter_batch_send_duration_seconds_sum 4",
+					"splitter_batch_send_duration_seconds_count 2",
+					"# HELP splitter_rows_published_total Row messages acknowledged by Kafka.",
+					"# TYPE splitter_rows_published_total counter",
+					"splitter_rows_published_total 3",
+				}, "\n")+"\n")
+			})
+		})
+	})
+}
+
+func TestTimer(t *testing.T) {
+	Convey("Given a timer that has recorded more durations than its sample holds", t, func() {
+		timer := NewRegisteredTimer(BatchSendLatencyName, gometrics.NewRegistry())
+		for i := 0; i < 2000; i++ {
+			timer.Update(time.Millisecond)
+		}
+
+		Convey("Then its total includes every duration", func() {
+			So(timer.Count(), ShouldEqual, 2000)
+			So(timer.Total(), ShouldEqual, 2*time.Second)
+			So(timer.Snapshot().Sum(), ShouldBeLessThan, int64(2*time.Second))
+		})
+	})
+}
+
+func TestActiveSplits(t *testing.T) {
+	Convey("Given a split that has started", t, func() {
+		before := ActiveSplits.Value()
+		SplitStarted()
+
+		Convey("Then it is counted as active until it finishes", func() {
+			So(ActiveSplits.Value(), ShouldEqual, before+1)
+			SplitFinished()
+			So(ActiveSplits.Value(), ShouldEqual, before)
+		})
+	})
+}
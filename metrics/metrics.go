@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// Registry the registry of the splitter's metrics, exposed by Handler.
+var Registry = gometrics.NewRegistry()
+
+// The names of the splitter's metrics.
+const (
+	EventsConsumedName   = "splitter_events_consumed_total"
+	BytesDownloadedName  = "splitter_bytes_downloaded_total"
+	RowsPublishedName    = "splitter_rows_published_total"
+	BatchSendLatencyName = "splitter_batch_send_duration_seconds"
+	FailedBatchesName    = "splitter_batches_failed_total"
+	ActiveSplitsName     = "splitter_active_splits"
+)
+
+var (
+	// EventsConsumed the number of messages consumed from the file-uploaded topic.
+	EventsConsumed = gometrics.NewRegisteredCounter(EventsConsumedName, Registry)
+	// BytesDownloaded the number of bytes read from the sources of the files being split, before decompression.
+	BytesDownloaded = gometrics.NewRegisteredCounter(BytesDownloadedName, Registry)
+	// RowsPublished the number of row messages acknowledged by Kafka.
+	RowsPublished = gometrics.NewRegisteredCounter(RowsPublishedName, Registry)
+	// BatchSendLatency the time taken to send each batch of rows to Kafka.
+	BatchSendLatency = NewRegisteredTimer(BatchSendLatencyName, Registry)
+	// FailedBatches the number of batches of rows that Kafka did not acknowledge.
+	FailedBatches = gometrics.NewRegisteredCounter(FailedBatchesName, Registry)
+)
+
+var activeSplits int64
+
+// ActiveSplits the number of splits in progress.
+var ActiveSplits = gometrics.NewRegisteredFunctionalGauge(ActiveSplitsName, Registry, func() int64 {
+	return atomic.LoadInt64(&activeSplits)
+})
+
+// SplitStarted records the start of a split, which must be followed by a call to SplitFinished.
+func SplitStarted() {
+	atomic.AddInt64(&activeSplits, 1)
+}
+
+// SplitFinished records the end of a split, whether it succeeded or failed.
+func SplitFinished() {
+	atomic.AddInt64(&activeSplits, -1)
+}
+
+var help = map[string]string{
+	EventsConsumedName:   "Messages consumed from the file-uploaded topic.",
+	BytesDownloadedName:  "Bytes read from the sources of the files being split, before decompression.",
+	RowsPublishedName:    "Row messages acknowledged by Kafka.",
+	BatchSendLatencyName: "Time taken to send a batch of rows to Kafka.",
+	FailedBatchesName:    "Batches of rows that Kafka did not acknowledge.",
+	ActiveSplitsName:     "Splits in progress.",
+}
+
+// Timer a go-metrics timer that also keeps the total of every duration it records. The sum of a go-metrics timer is
+// only that of its sample, which goes down as values are evicted from it, so cannot be exposed as a Prometheus sum.
+type Timer struct {
+	gometrics.Timer
+	total int64
+}
+
+// NewRegisteredTimer create a new Timer and register it in the registry under the name.
+func NewRegisteredTimer(name string, registry gometrics.Registry) *Timer {
+	timer := &Timer{Timer: gometrics.NewTimer()}
+	registry.Register(name, timer)
+	return timer
+}
+
+// Update records the duration.
+func (t *Timer) Update(d time.Duration) {
+	atomic.AddInt64(&t.total, int64(d))
+	t.Timer.Update(d)
+}
+
+// UpdateSince records the duration since the time.
+func (t *Timer) UpdateSince(start time.Time) {
+	t.Update(time.Since(start))
+}
+
+// Time records the duration of the function.
+func (t *Timer) Time(f func()) {
+	start := time.Now()
+	f()
+	t.UpdateSince(start)
+}
+
+// Total returns the total of every duration the timer has recorded.
+func (t *Timer) Total() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.total))
+}
@@ -1,56 +1,122 @@
 package ons_aws
 
 import (
-	"io"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
 
 	"github.com/ONSdigital/dp-csv-splitter/config"
-	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/source"
 	"github.com/ONSdigital/go-ns/log"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-// AWSClient interface defining the AWS client.
-type AWSService interface {
-	GetCSV(event *event.FileUploaded) (io.ReadCloser, error)
+// Service AWS S3 implementation of source.Source for s3:// URLs. A single session is shared by every request, with
+// one S3 client per region.
+type Service struct {
+	session *session.Session
+	mutex   sync.Mutex
+	clients map[string]*s3.S3
 }
 
-// Client AWS client implementation.
-type Service struct{}
-
-// NewClient create new AWSClient.
-func NewService() AWSService {
-	return &Service{}
-}
-
-// GetFile get the requested file from AWS. The caller is responsible for closing.
-func (cli *Service) GetCSV(event *event.FileUploaded) (io.ReadCloser, error) {
-	session, err := session.NewSession(&aws.Config{
-		Region: aws.String(config.AWSRegion),
-	})
+// NewService create new Service configured from the AWS settings in config.
+func NewService() (*Service, error) {
+	awsConfig := &aws.Config{
+		Region:           aws.String(config.AWSRegion),
+		S3ForcePathStyle: aws.Bool(config.AWSS3ForcePathStyle),
+	}
+	if len(config.AWSEndpoint) > 0 {
+		awsConfig.Endpoint = aws.String(config.AWSEndpoint)
+	}
+	if len(config.AWSCredentialsProfile) > 0 {
+		awsConfig.Credentials = credentials.NewSharedCredentials("", config.AWSCredentialsProfile)
+	}
 
+	session, err := session.NewSession(awsConfig)
 	if err != nil {
 		log.Error(err, nil)
 		return nil, err
 	}
 
+	return &Service{session: session, clients: make(map[string]*s3.S3)}, nil
+}
+
+// Open get the requested file from AWS, starting at the byte offset. The caller is responsible for closing.
+func (cli *Service) Open(url *url.URL, offset int64) (*source.File, error) {
+	bucket := url.Host
+	key := strings.TrimPrefix(url.Path, "/")
+
 	log.Debug("Requesting .csv file from AWS S3 bucket", log.Data{
-		"S3BucketName": event.GetBucketName(),
-		"filePath":     event.GetFilePath(),
+		"S3BucketName": bucket,
+		"filePath":     key,
+		"offset":       offset,
 	})
 
-	s3Service := s3.New(session)
 	request := &s3.GetObjectInput{}
-	request.SetBucket(event.GetBucketName())
-	request.SetKey(event.GetFilePath())
+	request.SetBucket(bucket)
+	request.SetKey(key)
+	if offset > 0 {
+		request.SetRange(fmt.Sprintf("bytes=%d-", offset))
+	}
 
-	result, err := s3Service.GetObject(request)
+	result, err := cli.client(bucket).GetObject(request)
 
 	if err != nil {
 		log.Error(err, nil)
 		return nil, err
 	}
 
-	return result.Body, nil
+	// Prefer the version ID when the bucket is versioned, S3 reports "null" when it is not.
+	file := &source.File{ReadCloser: result.Body}
+	if result.ContentEncoding != nil {
+		file.ContentEncoding = *result.ContentEncoding
+	}
+	if result.ContentLength != nil {
+		// A ranged request returns the length of the rest of the object, after the offset.
+		file.Size = offset + *result.ContentLength
+	}
+	if result.VersionId != nil && *result.VersionId != "null" {
+		file.Version = *result.VersionId
+	} else if result.ETag != nil {
+		file.Version = *result.ETag
+	}
+	return file, nil
+}
+
+// Healthcheck checks that AWS credentials are available and, if config.HealthcheckBucket is set, that the bucket can
+// be accessed with them.
+func (cli *Service) Healthcheck() error {
+	if _, err := cli.session.Config.Credentials.Get(); err != nil {
+		return err
+	}
+	if len(config.HealthcheckBucket) == 0 {
+		return nil
+	}
+
+	request := &s3.HeadBucketInput{}
+	request.SetBucket(config.HealthcheckBucket)
+	_, err := cli.client(config.HealthcheckBucket).HeadBucket(request)
+	return err
+}
+
+// client returns the S3 client for the region of the bucket, creating it on first use.
+func (cli *Service) client(bucket string) *s3.S3 {
+	region, ok := config.AWSBucketRegions[bucket]
+	if !ok {
+		region = config.AWSRegion
+	}
+
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+
+	client, ok := cli.clients[region]
+	if !ok {
+		client = s3.New(cli.session, aws.NewConfig().WithRegion(region))
+		cli.clients[region] = client
+	}
+	return client
 }
@@ -0,0 +1,79 @@
+package ons_aws_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+	"github.com/ONSdigital/dp-csv-splitter/ons_aws"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestService_Open(t *testing.T) {
+
+	Convey("Given an S3 compatible server using path-style addressing", t, func() {
+		var requestedPath string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestedPath = r.URL.Path
+			w.Header().Set("ETag", "\"etag\"")
+			w.Write([]byte("header\nrow1\n"))
+		}))
+		defer server.Close()
+
+		os.Setenv("AWS_ACCESS_KEY_ID", "test")
+		os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+		config.AWSEndpoint, config.AWSS3ForcePathStyle = server.URL, true
+		defer func() { config.AWSEndpoint, config.AWSS3ForcePathStyle = "", false }()
+
+		service, err := ons_aws.NewService()
+		So(err, ShouldBeNil)
+
+		Convey("When a file is opened", func() {
+			s3URL, _ := url.Parse("s3://bucket/dir/test.csv")
+			file, err := service.Open(s3URL, 0)
+			So(err, ShouldBeNil)
+			defer file.Close()
+
+			Convey("Then it is requested from the custom endpoint", func() {
+				b, _ := ioutil.ReadAll(file)
+				So(string(b), ShouldEqual, "header\nrow1\n")
+				So(requestedPath, ShouldEqual, "/bucket/dir/test.csv")
+				So(file.Version, ShouldEqual, "\"etag\"")
+			})
+		})
+	})
+}
+
+func TestService_Healthcheck(t *testing.T) {
+
+	Convey("Given an S3 compatible server that denies access to a bucket", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/allowed" {
+				w.WriteHeader(http.StatusForbidden)
+			}
+		}))
+		defer server.Close()
+
+		os.Setenv("AWS_ACCESS_KEY_ID", "test")
+		os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+		config.AWSEndpoint, config.AWSS3ForcePathStyle = server.URL, true
+		defer func() { config.AWSEndpoint, config.AWSS3ForcePathStyle, config.HealthcheckBucket = "", false, "" }()
+
+		service, err := ons_aws.NewService()
+		So(err, ShouldBeNil)
+
+		Convey("Then the check passes for an accessible bucket", func() {
+			config.HealthcheckBucket = "allowed"
+			So(service.Healthcheck(), ShouldBeNil)
+		})
+
+		Convey("Then the check fails for a bucket that cannot be accessed", func() {
+			config.HealthcheckBucket = "denied"
+			So(service.Healthcheck(), ShouldNotBeNil)
+		})
+	})
+}
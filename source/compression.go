@@ -0,0 +1,122 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats that are detected in uploaded files.
+const (
+	Gzip  = "gzip"
+	Bzip2 = "bzip2"
+	Zstd  = "zstd"
+)
+
+var magicBytes = map[string][]byte{
+	Gzip:  {0x1f, 0x8b},
+	Bzip2: []byte("BZh"),
+	Zstd:  {0x28, 0xb5, 0x2f, 0xfd},
+}
+
+// compressionOf returns the compression declared for a file by its content encoding or URL extension, or an empty
+// string if none is declared.
+func compressionOf(url *url.URL, contentEncoding string) string {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip", "x-gzip":
+		return Gzip
+	case "bzip2", "x-bzip2":
+		return Bzip2
+	case "zstd":
+		return Zstd
+	}
+
+	switch strings.ToLower(path.Ext(url.Path)) {
+	case ".gz", ".gzip":
+		return Gzip
+	case ".bz2":
+		return Bzip2
+	case ".zst":
+		return Zstd
+	}
+	return ""
+}
+
+// sniffCompression returns the compression identified by the magic bytes at the start of the reader.
+func sniffCompression(r *bufio.Reader) string {
+	for compression, magic := range magicBytes {
+		if peeked, _ := r.Peek(len(magic)); bytes.Equal(peeked, magic) {
+			return compression
+		}
+	}
+	return ""
+}
+
+// decompress wraps the file so it is decompressed while it is read, returning the compression of the file, or an empty
+// string if it is not compressed. The file must be read from its start, as the compression is also sniffed from its
+// magic bytes when it is not declared.
+func decompress(file *File, url *url.URL) (*File, string, error) {
+	buffered := bufio.NewReader(file)
+
+	compression := compressionOf(url, file.ContentEncoding)
+	if len(compression) == 0 {
+		compression = sniffCompression(buffered)
+	}
+
+	var reader io.Reader
+	var closer io.Closer = file
+	switch compression {
+	case Gzip:
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, "", err
+		}
+		reader = gzipReader
+	case Bzip2:
+		reader = bzip2.NewReader(buffered)
+	case Zstd:
+		zstdReader, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			file.Close()
+			return nil, "", err
+		}
+		reader, closer = zstdReader, &zstdCloser{decoder: zstdReader, file: file}
+	default:
+		reader = buffered
+	}
+
+	decompressed := &File{
+		ReadCloser: &decompressingReader{Reader: reader, Closer: closer},
+		Version:    file.Version,
+	}
+	// The decompressed size is not known until the whole file has been read, so Size is only kept for a file that is
+	// not compressed.
+	if len(compression) == 0 {
+		decompressed.Size = file.Size
+	}
+	return decompressed, compression, nil
+}
+
+type decompressingReader struct {
+	io.Reader
+	io.Closer
+}
+
+// zstdCloser releases the goroutines and memory of a zstd decoder along with closing the file it reads.
+type zstdCloser struct {
+	decoder *zstd.Decoder
+	file    io.Closer
+}
+
+func (c *zstdCloser) Close() error {
+	c.decoder.Close()
+	return c.file.Close()
+}
@@ -0,0 +1,95 @@
+package source_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/source"
+	"github.com/klauspost/compress/zstd"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry_OpenCompressed(t *testing.T) {
+
+	Convey("Given a registry with a file source", t, func() {
+		dir, _ := ioutil.TempDir("", "source")
+		defer os.RemoveAll(dir)
+
+		registry := source.NewRegistry()
+		registry.Register(source.NewFileSource(), "file")
+
+		var gzipped bytes.Buffer
+		writer := gzip.NewWriter(&gzipped)
+		writer.Write([]byte(fileContent))
+		writer.Close()
+
+		Convey("When a gzip file without a .gz extension is opened", func() {
+			path := filepath.Join(dir, "test.csv")
+			ioutil.WriteFile(path, gzipped.Bytes(), 0644)
+			fileURL, _ := url.Parse("file://" + path)
+
+			file, err := registry.Open(fileURL, 0)
+			So(err, ShouldBeNil)
+			defer file.Close()
+
+			Convey("Then it is detected from its magic bytes and decompressed", func() {
+				b, _ := ioutil.ReadAll(file)
+				So(string(b), ShouldEqual, fileContent)
+			})
+		})
+
+		Convey("When a .csv.gz file is resumed at an offset", func() {
+			path := filepath.Join(dir, "test.csv.gz")
+			ioutil.WriteFile(path, gzipped.Bytes(), 0644)
+			fileURL, _ := url.Parse("file://" + path)
+
+			file, err := registry.Open(fileURL, 7)
+			So(err, ShouldBeNil)
+			defer file.Close()
+
+			Convey("Then the offset is applied to the decompressed content", func() {
+				b, _ := ioutil.ReadAll(file)
+				So(string(b), ShouldEqual, "row1\nrow2\n")
+			})
+		})
+
+		Convey("When a gzip file without a .gz extension is resumed at an offset", func() {
+			path := filepath.Join(dir, "test.csv")
+			ioutil.WriteFile(path, gzipped.Bytes(), 0644)
+			fileURL, _ := url.Parse("file://" + path)
+
+			file, err := registry.Open(fileURL, 7)
+			So(err, ShouldBeNil)
+			defer file.Close()
+
+			Convey("Then it is detected from its magic bytes and the offset applied to the decompressed content", func() {
+				b, _ := ioutil.ReadAll(file)
+				So(string(b), ShouldEqual, "row1\nrow2\n")
+			})
+		})
+
+		Convey("When a zstd file is resumed at an offset", func() {
+			var compressed bytes.Buffer
+			encoder, _ := zstd.NewWriter(&compressed)
+			encoder.Write([]byte(fileContent))
+			encoder.Close()
+			path := filepath.Join(dir, "test.csv.zst")
+			ioutil.WriteFile(path, compressed.Bytes(), 0644)
+			fileURL, _ := url.Parse("file://" + path)
+
+			file, err := registry.Open(fileURL, 7)
+			So(err, ShouldBeNil)
+			defer file.Close()
+
+			Convey("Then it is decompressed and the offset applied to the decompressed content", func() {
+				b, _ := ioutil.ReadAll(file)
+				So(string(b), ShouldEqual, "row1\nrow2\n")
+			})
+		})
+	})
+}
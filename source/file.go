@@ -0,0 +1,44 @@
+package source
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// FileSource reads files from the local file system using file:// URLs.
+type FileSource struct{}
+
+// NewFileSource create a new FileSource.
+func NewFileSource() *FileSource {
+	return &FileSource{}
+}
+
+func (s *FileSource) Open(url *url.URL, offset int64) (*File, error) {
+	log.Debug("Opening local .csv file", log.Data{"path": url.Path, "offset": offset})
+
+	file, err := os.Open(url.Path)
+	if err != nil {
+		log.Error(err, nil)
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		log.Error(err, nil)
+		return nil, err
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		log.Error(err, nil)
+		return nil, err
+	}
+
+	version := strconv.FormatInt(info.ModTime().UnixNano(), 10) + "-" + strconv.FormatInt(info.Size(), 10)
+	return &File{ReadCloser: file, Version: version, Size: info.Size()}, nil
+}
@@ -0,0 +1,88 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// HTTPSource reads files from HTTP(S) file servers.
+type HTTPSource struct {
+	client *http.Client
+}
+
+// NewHTTPClient create a client for an HTTPSource, which gives up on a download after timeout, and on a server that
+// does not accept a connection, or respond with headers, within connectTimeout.
+func NewHTTPClient(timeout time.Duration, connectTimeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   connectTimeout,
+			ResponseHeaderTimeout: connectTimeout,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
+
+// NewHTTPSource create a new HTTPSource using the given client.
+func NewHTTPSource(client *http.Client) *HTTPSource {
+	return &HTTPSource{client: client}
+}
+
+func (s *HTTPSource) Open(url *url.URL, offset int64) (*File, error) {
+	log.Debug("Requesting .csv file over HTTP", log.Data{"url": url.String(), "offset": offset})
+
+	request, err := http.NewRequest("GET", url.String(), nil)
+	if err != nil {
+		log.Error(err, nil)
+		return nil, err
+	}
+	// Ask for the file as stored, compressed files are detected and decompressed by the Registry.
+	request.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		log.Error(err, nil)
+		return nil, err
+	}
+
+	switch {
+	case response.StatusCode == http.StatusPartialContent:
+	case response.StatusCode == http.StatusOK:
+		// The server ignored the range so skip to the offset ourselves.
+		if _, err := io.CopyN(ioutil.Discard, response.Body, offset); err != nil {
+			response.Body.Close()
+			log.Error(err, nil)
+			return nil, err
+		}
+	default:
+		response.Body.Close()
+		err := fmt.Errorf("unexpected response status %d from %s", response.StatusCode, url.String())
+		log.Error(err, nil)
+		return nil, err
+	}
+
+	version := response.Header.Get("ETag")
+	if len(version) == 0 {
+		version = response.Header.Get("Last-Modified")
+	}
+	file := &File{ReadCloser: response.Body, Version: version, ContentEncoding: response.Header.Get("Content-Encoding")}
+	if response.ContentLength >= 0 {
+		file.Size = response.ContentLength
+		if response.StatusCode == http.StatusPartialContent {
+			file.Size += offset
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,106 @@
+package source
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/ONSdigital/dp-csv-splitter/metrics"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// ErrUnsupportedScheme is returned when there is no source registered for the scheme of a URL.
+var ErrUnsupportedScheme = errors.New("no source registered for URL scheme")
+
+// Source defines a location CSV files can be read from.
+type Source interface {
+	// Open returns the file at the URL, starting at the byte offset. The caller is responsible for closing.
+	Open(url *url.URL, offset int64) (*File, error)
+}
+
+// File the body of a file along with its metadata.
+type File struct {
+	io.ReadCloser
+	// Version identifies the content of the file, such as an ETag, so a changed file can be told apart.
+	Version string
+	// ContentEncoding the encoding of the file as reported by its source, such as gzip.
+	ContentEncoding string
+	// Size the size in bytes of the whole file, not just the part from the offset, or 0 if it is not known.
+	Size int64
+}
+
+// Registry a Source that opens each URL with the Source registered for its scheme.
+type Registry struct {
+	sources map[string]Source
+}
+
+// NewRegistry create a new, empty, Registry.
+func NewRegistry() *Registry {
+	return &Registry{sources: make(map[string]Source)}
+}
+
+// Register the source for the given URL schemes.
+func (r *Registry) Register(source Source, schemes ...string) {
+	for _, scheme := range schemes {
+		r.sources[scheme] = source
+	}
+}
+
+// Open returns the file at the URL, decompressing it if it is compressed. The offset is a position in the
+// decompressed content, so the file is always opened at its start to identify its compression, from its content
+// encoding, extension or magic bytes. A compressed file is then skipped to the offset, while an uncompressed file is
+// opened again at the offset, unless the offset is at its end.
+func (r *Registry) Open(url *url.URL, offset int64) (*File, error) {
+	source, ok := r.sources[url.Scheme]
+	if !ok {
+		return nil, ErrUnsupportedScheme
+	}
+
+	file, err := open(source, url, 0)
+	if err != nil {
+		return nil, err
+	}
+	file, compression, err := decompress(file, url)
+	if err != nil || offset == 0 {
+		return file, err
+	}
+	if len(compression) == 0 {
+		file.Close()
+		if file.Size > 0 && offset >= file.Size {
+			// The split was checkpointed after its last row, and a ranged request from the end of the file would be
+			// refused, so the rest of the file is empty.
+			return &File{ReadCloser: ioutil.NopCloser(strings.NewReader("")), Version: file.Version, Size: file.Size}, nil
+		}
+		return open(source, url, offset)
+	}
+
+	log.Debug("Reading compressed file from the start to resume at offset", log.Data{"url": url.String(), "offset": offset, "compression": compression})
+	if _, err := io.CopyN(ioutil.Discard, file, offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// open opens the URL with the source, counting the bytes read from it, before any decompression, as downloaded.
+func open(source Source, url *url.URL, offset int64) (*File, error) {
+	file, err := source.Open(url, offset)
+	if err != nil {
+		return nil, err
+	}
+	file.ReadCloser = &countingReader{ReadCloser: file.ReadCloser}
+	return file, nil
+}
+
+// countingReader adds the number of bytes read through it to the bytes downloaded metric.
+type countingReader struct {
+	io.ReadCloser
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	metrics.BytesDownloaded.Inc(int64(n))
+	return n, err
+}
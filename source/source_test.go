@@ -0,0 +1,153 @@
+package source_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-csv-splitter/source"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const fileContent = "header\nrow1\nrow2\n"
+
+func TestRegistry_Open(t *testing.T) {
+
+	Convey("Given a registry with a file source", t, func() {
+		file, _ := ioutil.TempFile("", "source")
+		file.WriteString(fileContent)
+		file.Close()
+		defer os.Remove(file.Name())
+
+		registry := source.NewRegistry()
+		registry.Register(source.NewFileSource(), "file")
+
+		Convey("When a file URL is opened at an offset", func() {
+			fileURL, _ := url.Parse("file://" + file.Name())
+			opened, err := registry.Open(fileURL, 7)
+			So(err, ShouldBeNil)
+			defer opened.Close()
+
+			Convey("Then the file is read from the offset", func() {
+				b, _ := ioutil.ReadAll(opened)
+				So(string(b), ShouldEqual, "row1\nrow2\n")
+				So(opened.Version, ShouldNotBeEmpty)
+			})
+		})
+
+		Convey("When a file URL is opened at its end", func() {
+			fileURL, _ := url.Parse("file://" + file.Name())
+			opened, err := registry.Open(fileURL, int64(len(fileContent)))
+			So(err, ShouldBeNil)
+			defer opened.Close()
+
+			Convey("Then the file is empty but keeps its version and size", func() {
+				b, _ := ioutil.ReadAll(opened)
+				So(b, ShouldBeEmpty)
+				So(opened.Version, ShouldNotBeEmpty)
+				So(opened.Size, ShouldEqual, len(fileContent))
+			})
+		})
+
+		Convey("When a file URL is opened from its start", func() {
+			fileURL, _ := url.Parse("file://" + file.Name())
+			opened, err := registry.Open(fileURL, 0)
+			So(err, ShouldBeNil)
+			defer opened.Close()
+
+			Convey("Then the size of the uncompressed file is reported", func() {
+				So(opened.Size, ShouldEqual, len(fileContent))
+			})
+		})
+
+		Convey("When a URL with an unregistered scheme is opened", func() {
+			s3URL, _ := url.Parse("s3://bucket/dir/test.csv")
+			_, err := registry.Open(s3URL, 0)
+
+			Convey("Then an unsupported scheme error is returned", func() {
+				So(err, ShouldEqual, source.ErrUnsupportedScheme)
+			})
+		})
+	})
+}
+
+func TestHTTPSource_Open(t *testing.T) {
+
+	Convey("Given a file server", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", "\"etag\"")
+			w.Write([]byte(fileContent))
+		}))
+		defer server.Close()
+		httpSource := source.NewHTTPSource(http.DefaultClient)
+		fileURL, _ := url.Parse(server.URL + "/test.csv")
+
+		Convey("When a file is opened at an offset the server does not support ranges for", func() {
+			opened, err := httpSource.Open(fileURL, 7)
+			So(err, ShouldBeNil)
+			defer opened.Close()
+
+			Convey("Then the file is still read from the offset", func() {
+				b, _ := ioutil.ReadAll(opened)
+				So(string(b), ShouldEqual, "row1\nrow2\n")
+				So(opened.Version, ShouldEqual, "\"etag\"")
+			})
+		})
+	})
+}
+
+func TestNewHTTPClient(t *testing.T) {
+
+	Convey("Given a file server that is slow to respond", t, func() {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+		httpSource := source.NewHTTPSource(source.NewHTTPClient(time.Minute, 50*time.Millisecond))
+		fileURL, _ := url.Parse(server.URL + "/test.csv")
+
+		Convey("When a file is opened", func() {
+			_, err := httpSource.Open(fileURL, 0)
+
+			Convey("Then the request times out waiting for the response headers", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRegistry_OpenAtEnd(t *testing.T) {
+
+	Convey("Given a file server that refuses ranges starting at the end of a file", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", "\"etag\"")
+			if len(r.Header.Get("Range")) > 0 {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Write([]byte(fileContent))
+		}))
+		defer server.Close()
+		registry := source.NewRegistry()
+		registry.Register(source.NewHTTPSource(http.DefaultClient), "http")
+		fileURL, _ := url.Parse(server.URL + "/test.csv")
+
+		Convey("When a split checkpointed after its last row is resumed", func() {
+			opened, err := registry.Open(fileURL, int64(len(fileContent)))
+			So(err, ShouldBeNil)
+			defer opened.Close()
+
+			Convey("Then the rest of the file is empty and it keeps its version", func() {
+				b, _ := ioutil.ReadAll(opened)
+				So(b, ShouldBeEmpty)
+				So(opened.Version, ShouldEqual, "\"etag\"")
+			})
+		})
+	})
+}
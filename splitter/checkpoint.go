@@ -0,0 +1,131 @@
+package splitter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Checkpoints the store used to record the progress of each split. The default does not record anything.
+var Checkpoints CheckpointStore = noCheckpoints{}
+
+// Checkpoint the progress of a split, recorded after each acknowledged batch of rows.
+type Checkpoint struct {
+	DatasetID string `json:"datasetID"`
+	URL       string `json:"url"`
+	// Version the version of the file, such as its ETag, so the checkpoint is not applied to a changed file.
+	Version string `json:"version"`
+	// Index the index of the next row to send.
+	Index int `json:"index"`
+	// Offset the byte offset in the file of the next row to send.
+	Offset int64 `json:"offset"`
+	// Dialect the dialect of the file, which a resumed split cannot sniff as it starts after the header row.
+	Dialect *Dialect `json:"dialect,omitempty"`
+	// Header the column names from the header row, needed to send rows as maps after resuming.
+	Header []string `json:"header,omitempty"`
+	// RejectedRows the number of rows before Index that were sent to the dead letter topic.
+	RejectedRows int `json:"rejectedRows,omitempty"`
+	// Complete whether the file has been split. It is recorded for a member of an archive whose other members have not
+	// all been split yet, so the member is not split again when the archive is retried.
+	Complete bool `json:"complete,omitempty"`
+}
+
+// CheckpointStore defines how checkpoints are saved and restored, keyed by the URL of the file being split.
+type CheckpointStore interface {
+	// Get returns the checkpoint for the URL, or nil if there is none.
+	Get(url string) (*Checkpoint, error)
+	Save(checkpoint *Checkpoint) error
+	Delete(url string) error
+	// DeleteAll deletes the checkpoint for the URL along with those of any archive members or workbook sheets in it,
+	// whose URLs have the member or sheet appended as a fragment.
+	DeleteAll(url string) error
+}
+
+// FileCheckpointStore a CheckpointStore that keeps each checkpoint as a JSON file in a local directory.
+type FileCheckpointStore struct {
+	dir string
+}
+
+// NewFileCheckpointStore create a new FileCheckpointStore writing to dir.
+func NewFileCheckpointStore(dir string) (*FileCheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileCheckpointStore{dir: dir}, nil
+}
+
+func (store *FileCheckpointStore) Get(url string) (*Checkpoint, error) {
+	b, err := ioutil.ReadFile(store.path(url))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// Save writes the checkpoint to a temporary file first so a crash never leaves a partially written checkpoint.
+func (store *FileCheckpointStore) Save(checkpoint *Checkpoint) error {
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	path := store.path(checkpoint.URL)
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (store *FileCheckpointStore) Delete(url string) error {
+	if err := os.Remove(store.path(url)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (store *FileCheckpointStore) DeleteAll(url string) error {
+	paths, err := filepath.Glob(filepath.Join(store.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var checkpoint Checkpoint
+		if err := json.Unmarshal(b, &checkpoint); err != nil {
+			continue
+		}
+		if checkpoint.URL == url || strings.HasPrefix(checkpoint.URL, url+"#") {
+			if err := store.Delete(checkpoint.URL); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (store *FileCheckpointStore) path(url string) string {
+	hash := sha1.Sum([]byte(url))
+	return filepath.Join(store.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+type noCheckpoints struct{}
+
+func (noCheckpoints) Get(url string) (*Checkpoint, error) { return nil, nil }
+func (noCheckpoints) Save(checkpoint *Checkpoint) error   { return nil }
+func (noCheckpoints) Delete(url string) error             { return nil }
+func (noCheckpoints) DeleteAll(url string) error          { return nil }
@@ -0,0 +1,66 @@
+package splitter_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+
+	Convey("Given a file checkpoint store", t, func() {
+		dir, _ := ioutil.TempDir("", "checkpoints")
+		defer os.RemoveAll(dir)
+		store, err := splitter.NewFileCheckpointStore(dir)
+		So(err, ShouldBeNil)
+
+		url := "s3://bucket/dir/test.csv"
+
+		Convey("When no checkpoint has been saved", func() {
+			checkpoint, err := store.Get(url)
+
+			Convey("Then nil is returned", func() {
+				So(err, ShouldBeNil)
+				So(checkpoint, ShouldBeNil)
+			})
+		})
+
+		Convey("When a checkpoint is saved", func() {
+			expected := &splitter.Checkpoint{DatasetID: "werqae-asdqwrwf-erwe", URL: url, Index: 200, Offset: 51234}
+			So(store.Save(expected), ShouldBeNil)
+
+			Convey("Then it can be read back", func() {
+				actual, err := store.Get(url)
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, expected)
+			})
+
+			Convey("And it is removed when deleted", func() {
+				So(store.Delete(url), ShouldBeNil)
+				actual, err := store.Get(url)
+				So(err, ShouldBeNil)
+				So(actual, ShouldBeNil)
+			})
+		})
+
+		Convey("When the checkpoints of a file and of the members of an archive are saved", func() {
+			archiveURL := "s3://bucket/dir/archive.zip"
+			So(store.Save(&splitter.Checkpoint{URL: url}), ShouldBeNil)
+			So(store.Save(&splitter.Checkpoint{URL: archiveURL + "#a.csv"}), ShouldBeNil)
+			So(store.Save(&splitter.Checkpoint{URL: archiveURL + "#b.csv"}), ShouldBeNil)
+
+			Convey("Then deleting all of the archive's checkpoints leaves the other file's", func() {
+				So(store.DeleteAll(archiveURL), ShouldBeNil)
+				member, _ := store.Get(archiveURL + "#a.csv")
+				So(member, ShouldBeNil)
+				member, _ = store.Get(archiveURL + "#b.csv")
+				So(member, ShouldBeNil)
+				other, _ := store.Get(url)
+				So(other, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package splitter
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/Shopify/sarama"
+)
+
+// ErrRowRejected is logged for each row sent to the dead letter topic.
+var ErrRowRejected = errors.New("row rejected")
+
+// Error codes of the rows sent to the dead letter topic.
+const (
+	RowErrorTooLong           = "row_too_long"
+	RowErrorUnterminatedQuote = "unterminated_quote"
+	RowErrorInvalidEncoding   = "invalid_encoding"
+	RowErrorSchemaViolation   = "schema_violation"
+	RowErrorMarshal           = "marshal_failed"
+)
+
+// RejectedRow is sent to the dead letter topic for each row that could not be parsed, decoded or validated.
+type RejectedRow struct {
+	DatasetID string `json:"datasetID"`
+	Index     int    `json:"index"`
+	// Raw the bytes of the row as read from the file, cut short at the maximum row size.
+	Raw       []byte `json:"raw"`
+	ErrorCode string `json:"errorCode"`
+	Message   string `json:"message"`
+	S3URL     string `json:"s3URL"`
+	// ArchiveMember the name of the file in the zip archive at S3URL that the row was split from, if any.
+	ArchiveMember string `json:"archiveMember,omitempty"`
+}
+
+// rowErrorCode returns the dead letter error code for an error reading a row, or an empty string if the error is not
+// caused by the row itself and should fail the split.
+func rowErrorCode(err error) string {
+	switch err.(type) {
+	case *ErrRowTooLong:
+		return RowErrorTooLong
+	}
+	if err == ErrUnterminatedQuote {
+		return RowErrorUnterminatedQuote
+	}
+	return ""
+}
+
+// rejectRow sends a row to the dead letter topic. An error is returned if it could not be sent, as the row would
+// otherwise be lost.
+func rejectRow(event *event.FileUploaded, datasetID string, index int, raw string, code string, message string) error {
+	log.ErrorC(datasetID, ErrRowRejected, log.Data{
+		"index":     index,
+		"errorCode": code,
+		"message":   message,
+	})
+
+	rejected := RejectedRow{
+		DatasetID:     datasetID,
+		Index:         index,
+		Raw:           []byte(raw),
+		ErrorCode:     code,
+		Message:       message,
+		S3URL:         event.GetURL(),
+		ArchiveMember: event.ArchiveMember,
+	}
+
+	rejectedJSON, err := json.Marshal(rejected)
+	if err != nil {
+		return err
+	}
+
+	producerMsg := &sarama.ProducerMessage{
+		Topic: config.RowDeadLetterTopicName,
+		Key:   datasetEventKey(datasetID),
+		Value: sarama.ByteEncoder(rejectedJSON),
+	}
+	if _, _, err := Producer.SendMessage(producerMsg); err != nil {
+		log.ErrorC(datasetID, err, log.Data{"details": "Failed to send row to the dead letter topic"})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package splitter
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/ONSdigital/dp-csv-splitter/message/event"
+)
+
+// ErrUnsupportedDelimiter is returned for a delimiter or quote character that the splitter does not support.
+var ErrUnsupportedDelimiter = errors.New("unsupported delimiter or quote character")
+
+// Dialect the field delimiter and quote character of a delimited text file.
+type Dialect struct {
+	Delimiter string `json:"delimiter"`
+	Quote     string `json:"quote"`
+}
+
+// DefaultDialect the dialect of an RFC 4180 CSV file.
+var DefaultDialect = Dialect{Delimiter: ",", Quote: "\""}
+
+// The delimiters the splitter supports, in the order preferred when sniffing finds them equally often.
+var delimiters = []string{",", "\t", ";", "|"}
+
+var delimiterNames = map[string]string{
+	"comma":     ",",
+	"tab":       "\t",
+	"semicolon": ";",
+	"pipe":      "|",
+}
+
+var quotes = []string{"\"", "'"}
+
+// Delimiters implied by the extension of the file, before any compression extension.
+var extensionDelimiters = map[string]string{
+	".tsv": "\t",
+	".tab": "\t",
+	".psv": "|",
+}
+
+// dialectOf returns the dialect given by the event, falling back to the one implied by the file extension. sniff is
+// true when the event does not set the delimiter or quote and the extension does not imply one, in which case they
+// should be inferred from the header row. The sheet of an xlsx workbook is always converted to the default dialect, so
+// the event's dialect is ignored for it.
+func dialectOf(event *event.FileUploaded) (dialect Dialect, sniff bool, err error) {
+	dialect = DefaultDialect
+	sniff = true
+
+	if strings.EqualFold(path.Ext(event.S3URL.URL.Path), ".xlsx") {
+		return DefaultDialect, false, nil
+	}
+
+	if delimiter, ok := extensionDelimiters[strings.ToLower(path.Ext(trimCompressionExt(event.S3URL.URL.Path)))]; ok {
+		dialect.Delimiter = delimiter
+		sniff = false
+	}
+
+	if len(event.Delimiter) > 0 {
+		if dialect.Delimiter, err = parseDelimiter(event.Delimiter); err != nil {
+			return dialect, false, err
+		}
+		sniff = false
+	}
+
+	if len(event.Quote) > 0 {
+		if !contains(quotes, event.Quote) {
+			return dialect, false, ErrUnsupportedDelimiter
+		}
+		dialect.Quote = event.Quote
+		sniff = false
+	}
+
+	return dialect, sniff, nil
+}
+
+// parseDelimiter accepts either the delimiter character itself or its name, such as "tab".
+func parseDelimiter(delimiter string) (string, error) {
+	if named, ok := delimiterNames[strings.ToLower(delimiter)]; ok {
+		return named, nil
+	}
+	if delimiter == `\t` {
+		return "\t", nil
+	}
+	if !contains(delimiters, delimiter) {
+		return "", ErrUnsupportedDelimiter
+	}
+	return delimiter, nil
+}
+
+// SniffDialect infers the dialect of a file from its header row. The quote character is a single quote when the header
+// contains no double quotes and its first field is wrapped in single quotes, so an apostrophe in an unquoted column
+// name is not mistaken for a quote. The delimiter is the supported delimiter that appears most often outside quoted
+// fields. DefaultDialect is returned for anything that cannot be inferred.
+func SniffDialect(header string) Dialect {
+	dialect := DefaultDialect
+
+	if isSingleQuoted(header) && !strings.Contains(header, "\"") {
+		dialect.Quote = "'"
+	}
+
+	counts := make(map[string]int)
+	inQuotes := false
+	for _, c := range header {
+		if string(c) == dialect.Quote {
+			inQuotes = !inQuotes
+		} else if !inQuotes {
+			counts[string(c)]++
+		}
+	}
+
+	best := 0
+	for _, delimiter := range delimiters {
+		if counts[delimiter] > best {
+			dialect.Delimiter = delimiter
+			best = counts[delimiter]
+		}
+	}
+
+	return dialect
+}
+
+// isSingleQuoted returns whether the header starts with a field wrapped in single quotes, where the closing quote is
+// followed by a delimiter or the end of the header.
+func isSingleQuoted(header string) bool {
+	if !strings.HasPrefix(header, "'") {
+		return false
+	}
+	for i := 1; i < len(header); i++ {
+		if header[i] != '\'' {
+			continue
+		}
+		if i+1 < len(header) && header[i+1] == '\'' {
+			i++
+			continue
+		}
+		return i+1 == len(header) || contains(delimiters, header[i+1:i+2])
+	}
+	return false
+}
+
+// splitFields splits a record into its fields, removing the quotes around quoted fields and unescaping doubled quotes
+// within them. A quote in the middle of an unquoted field is kept as part of the field.
+func splitFields(record string, dialect Dialect) []string {
+	delimiter, quote := dialect.Delimiter[0], dialect.Quote[0]
+	var fields []string
+	var field []byte
+	inQuotes := false
+	quoted := false
+
+	for i := 0; i < len(record); i++ {
+		c := record[i]
+		switch {
+		case inQuotes && c == quote && i+1 < len(record) && record[i+1] == quote:
+			field = append(field, quote)
+			i++
+		case inQuotes && c == quote:
+			inQuotes = false
+		case inQuotes:
+			field = append(field, c)
+		case c == quote && len(field) == 0 && !quoted:
+			inQuotes, quoted = true, true
+		case c == delimiter:
+			fields = append(fields, string(field))
+			field, quoted = field[:0], false
+		default:
+			field = append(field, c)
+		}
+	}
+	return append(fields, string(field))
+}
+
+func trimCompressionExt(p string) string {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".gz", ".bz2", ".zst":
+		return strings.TrimSuffix(p, path.Ext(p))
+	default:
+		return p
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package splitter
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSniffDialect(t *testing.T) {
+
+	Convey("Given header rows in each supported dialect", t, func() {
+		Convey("Then the delimiter and quote character are inferred", func() {
+			So(SniffDialect("Observation,Data_Marking,Label"), ShouldResemble, DefaultDialect)
+			So(SniffDialect("Observation\tData_Marking\tLabel"), ShouldResemble, Dialect{Delimiter: "\t", Quote: "\""})
+			So(SniffDialect("Observation|Data_Marking|\"Label, Eng\""), ShouldResemble, Dialect{Delimiter: "|", Quote: "\""})
+			So(SniffDialect("'Observation';'Label, Eng'"), ShouldResemble, Dialect{Delimiter: ";", Quote: "'"})
+			So(SniffDialect("'Children's count',Label"), ShouldResemble, DefaultDialect)
+		})
+	})
+
+	Convey("Given a header row with a single column", t, func() {
+		Convey("Then the default dialect is used", func() {
+			So(SniffDialect("Observation"), ShouldResemble, DefaultDialect)
+		})
+	})
+}
+
+func TestDialectOf(t *testing.T) {
+
+	newEvent := func(rawURL string) *event.FileUploaded {
+		u, _ := url.Parse(rawURL)
+		return &event.FileUploaded{S3URL: event.NewS3URL(u)}
+	}
+
+	Convey("Given a CSV file without a dialect in the event", t, func() {
+		dialect, sniff, err := dialectOf(newEvent("s3://bucket/file.csv"))
+
+		Convey("Then the dialect is sniffed", func() {
+			So(err, ShouldBeNil)
+			So(sniff, ShouldBeTrue)
+			So(dialect, ShouldResemble, DefaultDialect)
+		})
+	})
+
+	Convey("Given a compressed tsv file", t, func() {
+		dialect, sniff, err := dialectOf(newEvent("s3://bucket/file.tsv.gz"))
+
+		Convey("Then the delimiter is a tab", func() {
+			So(err, ShouldBeNil)
+			So(sniff, ShouldBeFalse)
+			So(dialect.Delimiter, ShouldEqual, "\t")
+		})
+	})
+
+	Convey("Given an event naming the delimiter", t, func() {
+		e := newEvent("s3://bucket/file.csv")
+		e.Delimiter = "pipe"
+		dialect, sniff, err := dialectOf(e)
+
+		Convey("Then the event's delimiter is used", func() {
+			So(err, ShouldBeNil)
+			So(sniff, ShouldBeFalse)
+			So(dialect.Delimiter, ShouldEqual, "|")
+		})
+	})
+
+	Convey("Given an event for a sheet of a workbook naming the delimiter", t, func() {
+		e := newEvent("s3://bucket/workbook.xlsx")
+		e.Delimiter = "semicolon"
+		dialect, sniff, err := dialectOf(e)
+
+		Convey("Then the default dialect the sheet is converted to is used", func() {
+			So(err, ShouldBeNil)
+			So(sniff, ShouldBeFalse)
+			So(dialect, ShouldResemble, DefaultDialect)
+		})
+	})
+
+	Convey("Given an event with an unsupported delimiter", t, func() {
+		e := newEvent("s3://bucket/file.csv")
+		e.Delimiter = ":"
+		_, _, err := dialectOf(e)
+
+		Convey("Then an error is returned", func() {
+			So(err, ShouldEqual, ErrUnsupportedDelimiter)
+		})
+	})
+}
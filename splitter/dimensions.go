@@ -0,0 +1,101 @@
+package splitter
+
+import "strconv"
+
+// Observation the structured form of a row in the ONS Open-Data v4 layout.
+type Observation struct {
+	Value       string      `json:"value"`
+	DataMarking string      `json:"dataMarking,omitempty"`
+	Geography   *Geography  `json:"geography,omitempty"`
+	Time        *Time       `json:"time,omitempty"`
+	Dimensions  []Dimension `json:"dimensions"`
+}
+
+// Geography the geographic area an observation is for.
+type Geography struct {
+	Code string `json:"code"`
+}
+
+// Time the time period an observation is for.
+type Time struct {
+	ID       string `json:"id"`
+	LabelEng string `json:"labelEng"`
+	LabelCym string `json:"labelCym,omitempty"`
+	Type     string `json:"type"`
+}
+
+// Dimension one of the Dim_ID_n column groups of an observation.
+type Dimension struct {
+	ID           string `json:"id"`
+	LabelEng     string `json:"labelEng"`
+	LabelCym     string `json:"labelCym,omitempty"`
+	ItemID       string `json:"itemID"`
+	ItemLabelEng string `json:"itemLabelEng"`
+	ItemLabelCym string `json:"itemLabelCym,omitempty"`
+	IsTotal      bool   `json:"isTotal"`
+	IsSubTotal   bool   `json:"isSubTotal"`
+}
+
+// The positions of the v4 columns read into an Observation.
+const (
+	v4GeographicAreaColumn = 14
+	v4TimeIDColumn         = 17
+	v4TimeLabelEngColumn   = 18
+	v4TimeLabelCymColumn   = 19
+	v4TimeTypeColumn       = 20
+)
+
+// newObservation reads the fields of a v4 row into an Observation. Missing fields are treated as blank, and blank
+// dimension groups, geography and time are left out.
+func newObservation(fields []string) *Observation {
+	field := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+
+	observation := &Observation{
+		Value:       field(v4ObservationColumn),
+		DataMarking: field(v4DataMarkingColumn),
+		Dimensions:  []Dimension{},
+	}
+
+	if code := field(v4GeographicAreaColumn); len(code) > 0 {
+		observation.Geography = &Geography{Code: code}
+	}
+
+	if id := field(v4TimeIDColumn); len(id) > 0 {
+		observation.Time = &Time{
+			ID:       id,
+			LabelEng: field(v4TimeLabelEngColumn),
+			LabelCym: field(v4TimeLabelCymColumn),
+			Type:     field(v4TimeTypeColumn),
+		}
+	}
+
+	for start := len(v4Columns); start < len(fields); start += len(v4DimensionColumns) {
+		group := fields[start:minInt(start+len(v4DimensionColumns), len(fields))]
+		if isBlank(group) {
+			continue
+		}
+		observation.Dimensions = append(observation.Dimensions, Dimension{
+			ID:           field(start),
+			LabelEng:     field(start + 1),
+			LabelCym:     field(start + 2),
+			ItemID:       field(start + 3),
+			ItemLabelEng: field(start + 4),
+			ItemLabelCym: field(start + 5),
+			IsTotal:      parseFlag(field(start + 6)),
+			IsSubTotal:   parseFlag(field(start + 7)),
+		})
+	}
+
+	return observation
+}
+
+// parseFlag reads a total or subtotal flag, which is blank when false.
+func parseFlag(s string) bool {
+	flag, err := strconv.ParseBool(s)
+	return err == nil && flag
+}
@@ -0,0 +1,26 @@
+package splitter
+
+import (
+	"strconv"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+	"github.com/satori/go.uuid"
+)
+
+// NewDatasetID returns the ID for a new split of the file at url. When config.DeterministicIDs is enabled the ID is
+// derived from the URL and version of the file, otherwise a random ID is generated.
+func NewDatasetID(url string, version string) string {
+	if config.DeterministicIDs {
+		return uuid.NewV5(uuid.NamespaceURL, url+"#"+version).String()
+	}
+	return uuid.NewV4().String()
+}
+
+// newRowID returns the ID for the row at index. When config.DeterministicIDs is enabled the ID is derived from the
+// dataset ID and row index, otherwise a random ID is generated.
+func newRowID(datasetID string, index int) string {
+	if config.DeterministicIDs {
+		return uuid.NewV5(uuid.NamespaceURL, datasetID+"/"+strconv.Itoa(index)).String()
+	}
+	return uuid.NewV4().String()
+}
@@ -0,0 +1,32 @@
+package splitter_test
+
+import (
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewDatasetID(t *testing.T) {
+	url := "s3://bucket/dir/test.csv"
+
+	Convey("Given deterministic IDs are enabled", t, func() {
+		config.DeterministicIDs = true
+		defer func() { config.DeterministicIDs = false }()
+
+		Convey("Then the same file version always gets the same ID", func() {
+			So(splitter.NewDatasetID(url, "\"etag1\""), ShouldEqual, splitter.NewDatasetID(url, "\"etag1\""))
+		})
+
+		Convey("And a new version of the file gets a different ID", func() {
+			So(splitter.NewDatasetID(url, "\"etag1\""), ShouldNotEqual, splitter.NewDatasetID(url, "\"etag2\""))
+		})
+	})
+
+	Convey("Given deterministic IDs are disabled", t, func() {
+		Convey("Then each split gets a new ID", func() {
+			So(splitter.NewDatasetID(url, "\"etag1\""), ShouldNotEqual, splitter.NewDatasetID(url, "\"etag1\""))
+		})
+	})
+}
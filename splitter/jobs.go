@@ -0,0 +1,278 @@
+package splitter
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+)
+
+// States of a split job.
+const (
+	JobQueued      = "queued"
+	JobDownloading = "downloading"
+	JobSplitting   = "splitting"
+	JobComplete    = "complete"
+	JobFailed      = "failed"
+)
+
+// ErrJobInProgress is returned for a split of a dataset that is already being split.
+var ErrJobInProgress = errors.New("dataset is already being split")
+
+// Jobs the registry of in-flight and recent splits, updated by Processor as each split progresses.
+var Jobs = NewJobRegistry()
+
+// Job the progress of the split of a single dataset.
+type Job struct {
+	DatasetID string `json:"datasetID"`
+	SourceURL string `json:"sourceURL"`
+	State     string `json:"state"`
+	// RowsPublished the number of rows acknowledged by Kafka, including those of any earlier attempt that was resumed.
+	RowsPublished int        `json:"rowsPublished"`
+	Batches       int        `json:"batches"`
+	StartTime     *time.Time `json:"startTime,omitempty"`
+	EndTime       *time.Time `json:"endTime,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	// BytesRead the number of bytes of the file read so far.
+	BytesRead int64 `json:"bytesRead,omitempty"`
+	// Size the size in bytes of the file, when its source reports it.
+	Size int64 `json:"size,omitempty"`
+	// EstimatedTotalRows the number of rows in the file, estimated from the rows in the part of the file read so far.
+	// Only reported when the size of the file is known.
+	EstimatedTotalRows int `json:"estimatedTotalRows,omitempty"`
+}
+
+// Finished returns whether the job has completed or failed.
+func (job *Job) Finished() bool {
+	return job.State == JobComplete || job.State == JobFailed
+}
+
+// JobRegistry keeps the job of each split in progress, and of the most recent config.JobHistorySize finished splits.
+// It is safe for concurrent use.
+type JobRegistry struct {
+	mutex sync.RWMutex
+	jobs  map[string]*Job
+	// order the IDs of the jobs, oldest first.
+	order []string
+	// subscribers the channels progress is sent to, keyed by dataset ID.
+	subscribers map[string][]chan Job
+}
+
+// NewJobRegistry create a new, empty, JobRegistry.
+func NewJobRegistry() *JobRegistry {
+	return &JobRegistry{jobs: make(map[string]*Job), subscribers: make(map[string][]chan Job)}
+}
+
+// Get returns a copy of the job of the dataset, and whether there is one.
+func (r *JobRegistry) Get(datasetID string) (Job, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	job, ok := r.jobs[datasetID]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns a copy of every job, newest first.
+func (r *JobRegistry) List() []Job {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	jobs := make([]Job, 0, len(r.order))
+	for i := len(r.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, *r.jobs[r.order[i]])
+	}
+	return jobs
+}
+
+// Subscribe returns a copy of the job of the dataset, and a channel that receives a copy of the job each time the
+// split makes progress. The channel is closed once the job has finished, straight away if it already has, after which
+// Get reports the outcome. Progress is dropped rather than holding up the split if the subscriber falls behind. The
+// returned function must be called once the subscriber stops reading. False is returned if there is no job.
+func (r *JobRegistry) Subscribe(datasetID string) (Job, <-chan Job, func(), bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	job, ok := r.jobs[datasetID]
+	if !ok {
+		return Job{}, nil, nil, false
+	}
+
+	progress := make(chan Job, 16)
+	if job.Finished() {
+		close(progress)
+		return *job, progress, func() {}, true
+	}
+	r.subscribers[datasetID] = append(r.subscribers[datasetID], progress)
+
+	unsubscribe := func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		subscribers := r.subscribers[datasetID]
+		for i, subscriber := range subscribers {
+			if subscriber == progress {
+				r.subscribers[datasetID] = append(subscribers[:i], subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+	return *job, progress, unsubscribe, true
+}
+
+// Queue adds a job for a split that has been requested but not yet started, returning false without queuing it if
+// the dataset already has a job that has not finished. A finished job for the dataset is replaced.
+func (r *JobRegistry) Queue(datasetID string, sourceURL string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if job, ok := r.jobs[datasetID]; ok && !job.Finished() {
+		return false
+	}
+	r.add(&Job{DatasetID: datasetID, SourceURL: sourceURL, State: JobQueued})
+	return true
+}
+
+// Fail records that the split of a queued dataset failed before Processor could start it, such as when its file could
+// not be opened. A job that has already finished is left as it is.
+func (r *JobRegistry) Fail(datasetID string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if job, ok := r.jobs[datasetID]; ok && !job.Finished() {
+		end(job, err)
+		r.unsubscribeAll(datasetID)
+		r.evict()
+	}
+}
+
+// start records that the split of the dataset has started, with rowsPublished rows already sent by an earlier
+// attempt. A queued job for the dataset is moved on, while the job of any earlier attempt is replaced.
+func (r *JobRegistry) start(datasetID string, sourceURL string, startTime time.Time, rowsPublished int) {
+	r.put(&Job{
+		DatasetID:     datasetID,
+		SourceURL:     sourceURL,
+		State:         JobDownloading,
+		RowsPublished: rowsPublished,
+		StartTime:     &startTime,
+	})
+}
+
+// splitting records that the header of the dataset has been read and its rows are being sent.
+func (r *JobRegistry) splitting(datasetID string) {
+	r.update(datasetID, func(job *Job) {
+		job.State = JobSplitting
+	})
+}
+
+// batchSent records that a batch of rows was sent, of which rows were acknowledged, and sends the job to its
+// subscribers.
+func (r *JobRegistry) batchSent(datasetID string, rows int) {
+	r.update(datasetID, func(job *Job) {
+		job.RowsPublished += rows
+		job.Batches++
+	})
+}
+
+// progress records how far through the file the split has read, rowsRead rows in bytesRead bytes of a file of size
+// bytes, and sends the job to its subscribers.
+func (r *JobRegistry) progress(datasetID string, rowsRead int, bytesRead int64, size int64) {
+	r.update(datasetID, func(job *Job) {
+		job.BytesRead = bytesRead
+		job.Size = size
+		if size > 0 && bytesRead > 0 {
+			job.EstimatedTotalRows = int(int64(rowsRead) * size / bytesRead)
+		}
+	})
+}
+
+// finish records the outcome of the split of the dataset, which failed if err is not nil.
+func (r *JobRegistry) finish(datasetID string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if job, ok := r.jobs[datasetID]; ok {
+		end(job, err)
+	}
+	r.unsubscribeAll(datasetID)
+	r.evict()
+}
+
+func end(job *Job, err error) {
+	endTime := time.Now()
+	job.EndTime = &endTime
+	job.State = JobComplete
+	if err != nil {
+		job.State = JobFailed
+		job.LastError = err.Error()
+	}
+}
+
+// unsubscribeAll closes the channels of the subscribers to the dataset, as its job has finished.
+func (r *JobRegistry) unsubscribeAll(datasetID string) {
+	for _, subscriber := range r.subscribers[datasetID] {
+		close(subscriber)
+	}
+	delete(r.subscribers, datasetID)
+}
+
+func (r *JobRegistry) put(job *Job) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.add(job)
+}
+
+func (r *JobRegistry) add(job *Job) {
+	if _, ok := r.jobs[job.DatasetID]; ok {
+		r.remove(job.DatasetID)
+	}
+	r.jobs[job.DatasetID] = job
+	r.order = append(r.order, job.DatasetID)
+}
+
+// update applies the update to the job of the dataset and sends the updated job to its subscribers. Progress is
+// dropped for a subscriber that has fallen behind.
+func (r *JobRegistry) update(datasetID string, update func(job *Job)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	job, ok := r.jobs[datasetID]
+	if !ok {
+		return
+	}
+	update(job)
+
+	for _, subscriber := range r.subscribers[datasetID] {
+		select {
+		case subscriber <- *job:
+		default:
+		}
+	}
+}
+
+// evict removes the oldest finished jobs beyond config.JobHistorySize. Jobs in progress are always kept.
+func (r *JobRegistry) evict() {
+	finished := 0
+	for i := len(r.order) - 1; i >= 0; i-- {
+		id := r.order[i]
+		if !r.jobs[id].Finished() {
+			continue
+		}
+		if finished++; finished > config.JobHistorySize {
+			r.remove(id)
+		}
+	}
+}
+
+func (r *JobRegistry) remove(datasetID string) {
+	delete(r.jobs, datasetID)
+	for i, id := range r.order {
+		if id == datasetID {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			return
+		}
+	}
+}
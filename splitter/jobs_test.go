@@ -0,0 +1,141 @@
+package splitter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJobRegistry(t *testing.T) {
+	Convey("Given a job registry", t, func() {
+		jobs := NewJobRegistry()
+
+		Convey("When a queued job is started, sends a batch and fails", func() {
+			jobs.Queue("dataset", "s3://bucket/file.csv")
+			jobs.start("dataset", "s3://bucket/file.csv", time.Now(), 10)
+			jobs.splitting("dataset")
+			jobs.batchSent("dataset", 5)
+			jobs.finish("dataset", errors.New("broker unavailable"))
+
+			Convey("Then the job records its progress and error", func() {
+				job, ok := jobs.Get("dataset")
+				So(ok, ShouldBeTrue)
+				So(job.State, ShouldEqual, JobFailed)
+				So(job.RowsPublished, ShouldEqual, 15)
+				So(job.Batches, ShouldEqual, 1)
+				So(job.LastError, ShouldEqual, "broker unavailable")
+				So(jobs.List(), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When more splits finish than the history size", func() {
+			defaultJobHistorySize := config.JobHistorySize
+			config.JobHistorySize = 1
+			Reset(func() { config.JobHistorySize = defaultJobHistorySize })
+
+			jobs.start("in-progress", "s3://bucket/0.csv", time.Now(), 0)
+			for _, id := range []string{"first", "second"} {
+				jobs.start(id, "s3://bucket/"+id+".csv", time.Now(), 0)
+				jobs.finish(id, nil)
+			}
+
+			Convey("Then only the newest finished job is kept along with those in progress", func() {
+				_, ok := jobs.Get("first")
+				So(ok, ShouldBeFalse)
+				list := jobs.List()
+				So(list, ShouldHaveLength, 2)
+				So(list[0].DatasetID, ShouldEqual, "second")
+				So(list[1].DatasetID, ShouldEqual, "in-progress")
+			})
+		})
+	})
+}
+
+func TestJobRegistry_Queue(t *testing.T) {
+	Convey("Given a job registry with a queued job", t, func() {
+		jobs := NewJobRegistry()
+		So(jobs.Queue("dataset", "s3://bucket/file.csv"), ShouldBeTrue)
+
+		Convey("Then the dataset cannot be queued again until its job has finished", func() {
+			So(jobs.Queue("dataset", "s3://bucket/file.csv"), ShouldBeFalse)
+			jobs.Fail("dataset", errors.New("file not found"))
+			So(jobs.Queue("dataset", "s3://bucket/file.csv"), ShouldBeTrue)
+		})
+
+		Convey("Then a failure is not recorded against a job that has already finished", func() {
+			jobs.finish("dataset", nil)
+			jobs.Fail("dataset", errors.New("file not found"))
+			job, _ := jobs.Get("dataset")
+			So(job.State, ShouldEqual, JobComplete)
+			So(job.LastError, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestJobRegistry_Subscribe(t *testing.T) {
+	Convey("Given a subscriber to a split in progress", t, func() {
+		jobs := NewJobRegistry()
+		jobs.start("dataset", "s3://bucket/file.csv", time.Now(), 0)
+		job, progress, unsubscribe, ok := jobs.Subscribe("dataset")
+		defer unsubscribe()
+		So(ok, ShouldBeTrue)
+		So(job.State, ShouldEqual, JobDownloading)
+
+		Convey("When the split makes progress", func() {
+			jobs.batchSent("dataset", 100)
+			jobs.progress("dataset", 100, 1000, 10000)
+
+			Convey("Then the subscriber receives the job once the batch is acknowledged", func() {
+				update := <-progress
+				So(update.RowsPublished, ShouldEqual, 100)
+				So(update.Batches, ShouldEqual, 1)
+			})
+
+			Convey("Then the subscriber receives the job with the total rows estimated from the file size", func() {
+				<-progress
+				update := <-progress
+				So(update.RowsPublished, ShouldEqual, 100)
+				So(update.BytesRead, ShouldEqual, 1000)
+				So(update.Size, ShouldEqual, 10000)
+				So(update.EstimatedTotalRows, ShouldEqual, 1000)
+			})
+		})
+
+		Convey("When the split finishes", func() {
+			jobs.finish("dataset", nil)
+
+			Convey("Then the channel is closed", func() {
+				_, open := <-progress
+				So(open, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a finished split", t, func() {
+		jobs := NewJobRegistry()
+		jobs.start("dataset", "s3://bucket/file.csv", time.Now(), 0)
+		jobs.finish("dataset", errors.New("broker unavailable"))
+
+		Convey("When it is subscribed to", func() {
+			job, progress, _, ok := jobs.Subscribe("dataset")
+
+			Convey("Then its job is returned with a closed channel", func() {
+				So(ok, ShouldBeTrue)
+				So(job.State, ShouldEqual, JobFailed)
+				_, open := <-progress
+				So(open, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a dataset without a job", t, func() {
+		_, _, _, ok := NewJobRegistry().Subscribe("unknown")
+
+		Convey("Then it cannot be subscribed to", func() {
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
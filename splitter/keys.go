@@ -0,0 +1,61 @@
+package splitter
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+	"github.com/Shopify/sarama"
+)
+
+// Partition key strategies for the messages sent to Kafka.
+const (
+	// KeyByDataset keys every message with its dataset ID so the rows of a dataset stay in order on one partition.
+	KeyByDataset = "dataset"
+	// KeyByDimensions keys each row with a hash of its dimension values so a compacted topic keeps the latest
+	// observation for each set of dimensions.
+	KeyByDimensions = "dimensions"
+	// KeyRoundRobin sends messages without a key so they are spread evenly across partitions.
+	KeyRoundRobin = "roundrobin"
+)
+
+// The leading columns of a row that hold the observation rather than its dimensions.
+const observationColumns = 2
+
+// rowKey returns the partition key for a row message using the configured strategy.
+func rowKey(datasetID string, row string, dialect Dialect) sarama.Encoder {
+	switch config.PartitionKey {
+	case KeyRoundRobin:
+		return nil
+	case KeyByDimensions:
+		return sarama.StringEncoder(datasetID + ":" + dimensionsHash(row, dialect))
+	default:
+		return sarama.StringEncoder(datasetID)
+	}
+}
+
+// datasetEventKey returns the partition key for a dataset event. Only round robin leaves it unkeyed, otherwise the
+// dataset ID is used so the events for a dataset stay in order.
+func datasetEventKey(datasetID string) sarama.Encoder {
+	if config.PartitionKey == KeyRoundRobin {
+		return nil
+	}
+	return sarama.StringEncoder(datasetID)
+}
+
+func dimensionsHash(row string, dialect Dialect) string {
+	hash := fnv.New64a()
+
+	fields := splitFields(row, dialect)
+	if len(fields) < observationColumns {
+		// Fall back to the whole row so rows without dimensions still get a stable key.
+		hash.Write([]byte(row))
+	} else {
+		for _, field := range fields[observationColumns:] {
+			hash.Write([]byte(field))
+			hash.Write([]byte{0})
+		}
+	}
+
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
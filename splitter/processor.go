@@ -3,22 +3,27 @@ package splitter
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
 	"strconv"
 	"time"
+	"unicode/utf8"
 
+	"github.com/ONSdigital/dp-csv-splitter/charset"
 	"github.com/ONSdigital/dp-csv-splitter/config"
 	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/metrics"
+	"github.com/ONSdigital/dp-csv-splitter/source"
 	"github.com/ONSdigital/go-ns/log"
 	"github.com/Shopify/sarama"
-	"github.com/satori/go.uuid"
 )
 
 var Producer sarama.SyncProducer
 
 // CSVProcessor defines the CSVProcessor interface.
 type CSVProcessor interface {
-	Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string)
+	Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string, version string) error
+	Resume(r io.Reader, event *event.FileUploaded, startTime time.Time, checkpoint *Checkpoint) error
 }
 
 // Processor implementation of the CSVProcessor interface.
@@ -29,65 +34,283 @@ func NewCSVProcessor() *Processor {
 	return &Processor{}
 }
 
+// Row formats of a RowMessage.
+const (
+	// RowFormatRaw sends the text of each row in Row.
+	RowFormatRaw = "raw"
+	// RowFormatMap sends the fields of each row in Fields, keyed by the column names of the header row.
+	RowFormatMap = "map"
+	// RowFormatDimensions sends the text of each row in Row, and its v4 dimensions, geography and time in Observation.
+	RowFormatDimensions = "dimensions"
+)
+
 type RowMessage struct {
 	Index     int    `json:"index"`
-	Row       string `json:"row"`
+	Row       string `json:"row,omitempty"`
 	StartTime int64  `json:"startTime"`
 	DatasetID string `json:"datasetID"`
 	S3URL     string `json:"s3URL"`
 	RowID     string `json:"rowID"`
+	// ArchiveMember the name of the file in the zip archive at S3URL that the row was split from, if any.
+	ArchiveMember string `json:"archiveMember,omitempty"`
+	// Fields the fields of the row keyed by column name, sent instead of Row when config.RowFormat is "map".
+	Fields map[string]string `json:"fields,omitempty"`
+	// Observation the structured form of a v4 row, sent along with Row when config.RowFormat is "dimensions".
+	Observation *Observation `json:"observation,omitempty"`
 }
 
+// Dataset statuses reported in a DatasetStartedEvent or DatasetSplitEvent.
+const (
+	StatusStarted  = "started"
+	StatusComplete = "complete"
+	StatusFailed   = "failed"
+)
+
 type DatasetSplitEvent struct {
 	DatasetID string `json:"datasetID"`
-	TotalRows int    `json:"totalRows"`
-	SplitTime int64  `json:"lastUpdate"`
+	// TotalRows the number of rows sent to the row topic, the same as AcceptedRows.
+	TotalRows int `json:"totalRows"`
+	// AcceptedRows the number of rows sent to the row topic.
+	AcceptedRows int `json:"acceptedRows"`
+	// RejectedRows the number of rows sent to the dead letter topic because they could not be parsed, decoded or
+	// validated.
+	RejectedRows int    `json:"rejectedRows"`
+	SplitTime    int64  `json:"lastUpdate"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+	LastIndex    int    `json:"lastIndex"`
+	S3URL        string `json:"s3URL"`
+	// ArchiveMember the name of the file in the zip archive at S3URL that the dataset was split from, if any.
+	ArchiveMember string `json:"archiveMember,omitempty"`
+	// Dialect the delimiter and quote character the dataset was split with, reported once the split is complete.
+	Dialect *Dialect `json:"dialect,omitempty"`
+}
+
+// DatasetStartedEvent is sent to the dataset topic before the first row of a dataset, so consumers can read the
+// columns of the dataset rather than assuming a layout.
+type DatasetStartedEvent struct {
+	DatasetID   string   `json:"datasetID"`
+	Status      string   `json:"status"`
+	StartTime   int64    `json:"startTime"`
+	Header      []string `json:"header"`
+	ColumnCount int      `json:"columnCount"`
+	S3URL       string   `json:"s3URL"`
+	// ArchiveMember the name of the file in the zip archive at S3URL that the dataset is split from, if any.
+	ArchiveMember string   `json:"archiveMember,omitempty"`
+	Dialect       *Dialect `json:"dialect"`
+}
+
+// SplitError is returned by Process when a dataset could not be completely split.
+type SplitError struct {
+	DatasetID string
+	// LastIndex the index of the last row successfully sent to Kafka, or -1 if no rows were sent.
+	LastIndex int
+	Err       error
+}
+
+func (e *SplitError) Error() string {
+	return fmt.Sprintf("failed to split dataset %s after row index %d: %s", e.DatasetID, e.LastIndex, e.Err)
+}
+
+// Process splits the CSV file read from r into row messages, starting from its header row. The version of the file is
+// saved in its checkpoints so a split is only resumed from a checkpoint of the same file.
+func (p *Processor) Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string, version string) error {
+	return p.run(r, event, startTime, &Checkpoint{DatasetID: datasetID, URL: event.GetSourceURL(), Version: version}, true)
 }
 
-func (p *Processor) Process(r io.Reader, event *event.FileUploaded, startTime time.Time, datasetID string) {
+// Resume continues an interrupted split from its checkpoint. The reader must start at the checkpoint's byte offset.
+func (p *Processor) Resume(r io.Reader, event *event.FileUploaded, startTime time.Time, checkpoint *Checkpoint) error {
+	log.DebugC(checkpoint.DatasetID, "Resuming split from checkpoint", log.Data{
+		"index":  checkpoint.Index,
+		"offset": checkpoint.Offset,
+	})
+	return p.run(r, event, startTime, checkpoint, false)
+}
+
+// run splits the dataset, recording its progress in Jobs.
+func (p *Processor) run(r io.Reader, event *event.FileUploaded, startTime time.Time, checkpoint *Checkpoint, readHeader bool) error {
+	Jobs.start(checkpoint.DatasetID, event.GetSourceURL(), startTime, checkpoint.Index-checkpoint.RejectedRows)
+	err := p.split(r, event, startTime, checkpoint, readHeader)
+	Jobs.finish(checkpoint.DatasetID, err)
+	return err
+}
+
+func (p *Processor) split(r io.Reader, event *event.FileUploaded, startTime time.Time, checkpoint *Checkpoint, readHeader bool) error {
+	metrics.SplitStarted()
+	defer metrics.SplitFinished()
+
+	var datasetID = checkpoint.DatasetID
+	var index = checkpoint.Index
+	var lastIndex = index - 1
+	var rejectedRows = checkpoint.RejectedRows
+	var deliveredRows = index - rejectedRows
 
-	scanner := bufio.NewScanner(r)
-	var index = 0
+	buffered := bufio.NewReader(r)
+	encoding, bomLength, err := inputEncoding(buffered, event, readHeader)
+	if err != nil {
+		return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, err)
+	}
+
+	// Single byte encodings are transcoded one row at a time so the checkpoint offsets remain positions in the file.
+	// UTF-16 has to be transcoded as a stream, so those offsets would not match the file and checkpoints are not saved.
+	var input io.Reader = buffered
+	if charset.IsUTF16(encoding) {
+		input = charset.NewUTF16Reader(buffered, encoding)
+	}
+	reader := NewRecordReader(input, config.MaxRowSize)
+	var baseOffset = checkpoint.Offset + int64(bomLength)
+	var size = sizeOf(r)
+	if charset.IsUTF16(encoding) {
+		// The offsets of a UTF-16 file are positions in its UTF-8 transcoding, so cannot be compared to its size.
+		size = 0
+	}
 	var batchSize = config.BatchSize
+	if event.BatchSize > 0 {
+		batchSize = event.BatchSize
+	}
 	var batchNumber = 1
 	var isFinalBatch = false
 	var totalRows int
 
-	// Scan and discard header row (for now) - the data rows contain sufficient information about the structure
-	if !scanner.Scan() && scanner.Err() == io.EOF {
-		log.DebugC(datasetID, "Encountered EOF immediately when processing header row", nil)
-		return
+	dialect, sniff, err := dialectOf(event)
+	if err != nil {
+		return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, err)
+	}
+	if checkpoint.Dialect != nil {
+		dialect, sniff = *checkpoint.Dialect, false
+	}
+	reader.SetQuote(dialect.Quote[0])
+	reader.SetDelimiter(dialect.Delimiter[0])
+
+	validator, err := NewValidator(config.Schema)
+	if err != nil {
+		return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, err)
+	}
+
+	// The header row is announced in a DatasetStartedEvent before any rows are sent. A resumed split starts part way
+	// through the file, after the header, so it uses the columns saved in the checkpoint.
+	var columns = checkpoint.Header
+	if readHeader {
+		header, err := reader.Read()
+		if err == io.EOF {
+			log.DebugC(datasetID, "Encountered EOF immediately when processing header row", nil)
+			return nil
+		} else if err != nil {
+			return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, err)
+		}
+		header = charset.DecodeString(header, encoding)
+		if sniff {
+			dialect = SniffDialect(header)
+			reader.SetQuote(dialect.Quote[0])
+			reader.SetDelimiter(dialect.Delimiter[0])
+			log.DebugC(datasetID, "Sniffed dialect from header row", log.Data{"dialect": dialect})
+		}
+		columns = splitFields(header, dialect)
+	}
+
+	if validator != nil && len(columns) > 0 {
+		if violations := validator.ValidateHeader(columns); len(violations) > 0 {
+			return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, &SchemaError{Schema: config.Schema, Violations: violations})
+		}
 	}
 
+	if readHeader && config.SendStartedEvents {
+		if err := sendDatasetStartedEvent(event, datasetID, startTime, columns, dialect); err != nil {
+			return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, err)
+		}
+	}
+
+	Jobs.splitting(datasetID)
+
 	for !isFinalBatch {
 		// each batch
 
 		log.DebugC(datasetID, "Processing batch number "+strconv.Itoa(batchNumber)+" index: "+strconv.Itoa(index), nil)
-		var msgs []*sarama.ProducerMessage = make([]*sarama.ProducerMessage, batchSize)
+		Jobs.progress(datasetID, index, baseOffset+reader.Offset(), size)
+		var msgs []*sarama.ProducerMessage = make([]*sarama.ProducerMessage, 0, batchSize)
 
-		for batchIndex := 0; batchIndex < batchSize && !isFinalBatch; batchIndex++ {
+		for len(msgs) < batchSize && !isFinalBatch {
 			// each row in the batch
-			scanSuccessful := scanner.Scan()
-			if !scanSuccessful {
+			row, err := reader.Read()
+			if err == io.EOF {
 				log.DebugC(datasetID, "EOF reached, no more records to process", nil)
 				isFinalBatch = true
-				msgs = msgs[0:batchIndex] // the last batch is smaller than batch size, so resize the slice.
-				log.Debug(strconv.Itoa(batchIndex)+" messages in the final batch.", nil)
-				totalRows = ((batchNumber - 1) * batchSize) + batchIndex
+				log.Debug(strconv.Itoa(len(msgs))+" messages in the final batch.", nil)
+				totalRows = index - rejectedRows
 				log.DebugC(datasetID, strconv.Itoa(totalRows)+" messages in total.", nil)
-				sendDatasetSplitEvent(datasetID, totalRows)
+				continue
+			}
+
+			// Rows that cannot be parsed, decoded or validated are sent to the dead letter topic rather than on to
+			// the loader. Any other error means only part of the file could be read, so the split fails.
+			code, reason := rowErrorCode(err), ""
+			if err != nil {
+				if len(code) == 0 {
+					return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, err)
+				}
+				reason = err.Error()
+			}
+
+			raw := row
+			var producerMsg *sarama.ProducerMessage
+			if len(code) == 0 {
+				row = charset.DecodeString(row, encoding)
+				if !utf8.ValidString(row) {
+					code, reason = RowErrorInvalidEncoding, "row is not valid "+encoding
+				}
+			}
+			if len(code) == 0 && validator != nil {
+				if violations := validator.ValidateRow(splitFields(row, dialect)); len(violations) > 0 {
+					code, reason = RowErrorSchemaViolation, joinViolations(violations)
+				}
+			}
+			if len(code) == 0 {
+				if producerMsg, err = createMessage(row, index, event, startTime, datasetID, dialect, columns); err != nil {
+					code, reason = RowErrorMarshal, err.Error()
+				}
+			}
+
+			if len(code) > 0 {
+				if err := rejectRow(event, datasetID, index, raw, code, reason); err != nil {
+					return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, err)
+				}
+				rejectedRows++
 			} else {
-				producerMsg := createMessage(scanner.Text(), index, event, startTime, datasetID)
-				msgs[batchIndex] = producerMsg
-				index++
+				msgs = append(msgs, producerMsg)
 			}
+			index++
 		}
 
-		err := Producer.SendMessages(msgs)
+		sendStart := time.Now()
+		err = Producer.SendMessages(msgs)
+		metrics.BatchSendLatency.UpdateSince(sendStart)
 		if err != nil {
 			log.ErrorC(datasetID, err, log.Data{
 				"details": "Failed to add messages to Kafka",
 			})
+			delivered := countDelivered(msgs, err)
+			metrics.FailedBatches.Inc(1)
+			metrics.RowsPublished.Inc(int64(delivered))
+			deliveredRows += delivered
+			Jobs.batchSent(datasetID, delivered)
+			return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, err)
+		}
+		lastIndex = index - 1
+		deliveredRows += len(msgs)
+		metrics.RowsPublished.Inc(int64(len(msgs)))
+		Jobs.batchSent(datasetID, len(msgs))
+
+		if !charset.IsUTF16(encoding) {
+			saveCheckpoint(&Checkpoint{
+				DatasetID:    datasetID,
+				URL:          checkpoint.URL,
+				Version:      checkpoint.Version,
+				Index:        index,
+				Offset:       baseOffset + reader.Offset(),
+				Dialect:      &dialect,
+				Header:       columns,
+				RejectedRows: rejectedRows,
+			})
 		}
 
 		batchNumber++
@@ -96,28 +319,137 @@ func (p *Processor) Process(r io.Reader, event *event.FileUploaded, startTime ti
 	log.DebugC(datasetID, "Kafka Loop details", log.Data{
 		"Enqueued": index,
 	})
+
+	// Only announce completion once every row batch has been acknowledged.
+	if err := sendDatasetSplitEvent(event, datasetID, totalRows, lastIndex, rejectedRows, dialect); err != nil {
+		return failSplit(event, datasetID, lastIndex, deliveredRows, rejectedRows, err)
+	}
+
+	if err := Checkpoints.Delete(checkpoint.URL); err != nil {
+		log.ErrorC(datasetID, err, log.Data{"details": "Failed to delete checkpoint"})
+	}
+	return nil
+}
+
+// inputEncoding returns the character encoding of the input, from the event if it is given, otherwise from the byte
+// order mark at the start of the file. Any byte order mark is consumed and its length returned. An empty encoding
+// means each row is checked and treated as Windows-1252 if it is not valid UTF-8.
+func inputEncoding(r *bufio.Reader, event *event.FileUploaded, readHeader bool) (string, int, error) {
+	encoding, err := charset.Normalise(event.Encoding)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// A resumed split starts after the byte order mark.
+	if !readHeader {
+		return encoding, 0, nil
+	}
+
+	bomEncoding, bomLength, err := charset.ReadBOM(r)
+	if len(encoding) == 0 {
+		encoding = bomEncoding
+	}
+	return encoding, bomLength, err
+}
+
+// saveCheckpoint records the progress of a split. Failing to save is not fatal, it only means a restarted split
+// resumes from an earlier checkpoint and resends some rows.
+func saveCheckpoint(checkpoint *Checkpoint) {
+	if err := Checkpoints.Save(checkpoint); err != nil {
+		log.ErrorC(checkpoint.DatasetID, err, log.Data{"details": "Failed to save checkpoint"})
+	}
+}
+
+// sizeOf returns the size of the file read by r, or 0 if r is not a source.File or its size is not known.
+func sizeOf(r io.Reader) int64 {
+	if file, ok := r.(*source.File); ok {
+		return file.Size
+	}
+	return 0
 }
 
-func sendDatasetSplitEvent(datasetID string, totalRows int) {
+// countDelivered returns how many of msgs were acknowledged when SendMessages returned err. Only the messages
+// listed in a sarama.ProducerErrors are known to have failed; any other error means none can be relied upon.
+func countDelivered(msgs []*sarama.ProducerMessage, err error) int {
+	if producerErrs, ok := err.(sarama.ProducerErrors); ok {
+		return len(msgs) - len(producerErrs)
+	}
+	return 0
+}
+
+// failSplit reports the dataset as failed on the dataset topic and returns the SplitError for the caller. The event
+// reports deliveredRows as the total and accepted rows, which may include rows acknowledged after lastIndex in a partly
+// failed batch, along with the rejectedRows sent to the dead letter topic.
+func failSplit(event *event.FileUploaded, datasetID string, lastIndex int, deliveredRows int, rejectedRows int, err error) error {
+	splitErr := &SplitError{DatasetID: datasetID, LastIndex: lastIndex, Err: err}
+	log.ErrorC(datasetID, splitErr, nil)
 
 	message := DatasetSplitEvent{
-		DatasetID: datasetID,
-		TotalRows: totalRows,
-		SplitTime: time.Now().UTC().Unix() * 1000, // unix time in milliseconds
+		DatasetID:     datasetID,
+		TotalRows:     deliveredRows,
+		AcceptedRows:  deliveredRows,
+		RejectedRows:  rejectedRows,
+		SplitTime:     time.Now().UTC().Unix() * 1000, // unix time in milliseconds
+		Status:        StatusFailed,
+		Reason:        err.Error(),
+		LastIndex:     lastIndex,
+		S3URL:         event.GetURL(),
+		ArchiveMember: event.ArchiveMember,
+	}
+	if sendErr := sendDatasetEvent(datasetID, message); sendErr != nil {
+		log.ErrorC(datasetID, sendErr, log.Data{"details": "Failed to send dataset failed event"})
+	}
+
+	return splitErr
+}
+
+func sendDatasetStartedEvent(event *event.FileUploaded, datasetID string, startTime time.Time, columns []string, dialect Dialect) error {
+
+	message := DatasetStartedEvent{
+		DatasetID:     datasetID,
+		Status:        StatusStarted,
+		StartTime:     startTime.UTC().Unix(),
+		Header:        columns,
+		ColumnCount:   len(columns),
+		S3URL:         event.GetURL(),
+		ArchiveMember: event.ArchiveMember,
+		Dialect:       &dialect,
 	}
 
+	return sendDatasetEvent(datasetID, message)
+}
+
+func sendDatasetSplitEvent(event *event.FileUploaded, datasetID string, totalRows int, lastIndex int, rejectedRows int, dialect Dialect) error {
+
+	message := DatasetSplitEvent{
+		DatasetID:     datasetID,
+		TotalRows:     totalRows,
+		AcceptedRows:  totalRows,
+		RejectedRows:  rejectedRows,
+		SplitTime:     time.Now().UTC().Unix() * 1000, // unix time in milliseconds
+		Status:        StatusComplete,
+		LastIndex:     lastIndex,
+		S3URL:         event.GetURL(),
+		ArchiveMember: event.ArchiveMember,
+		Dialect:       &dialect,
+	}
+
+	return sendDatasetEvent(datasetID, message)
+}
+
+func sendDatasetEvent(datasetID string, message interface{}) error {
+
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
 		log.Error(err, log.Data{
 			"details": "Could not create the json representation of message",
-			"message": messageJSON,
 		})
-		panic(err)
+		return err
 	}
 
 	producerMsg := &sarama.ProducerMessage{
 		Topic: config.DatasetTopicName,
-		Key:   sarama.StringEncoder(datasetID),
+		Key:   datasetEventKey(datasetID),
 		Value: sarama.ByteEncoder(messageJSON),
 	}
 
@@ -127,18 +459,43 @@ func sendDatasetSplitEvent(datasetID string, totalRows int) {
 		log.Error(err, log.Data{
 			"details": "Failed to add messages to Kafka",
 		})
+		return err
 	}
+	return nil
 }
 
-func createMessage(row string, index int, event *event.FileUploaded, startTime time.Time, datasetID string) *sarama.ProducerMessage {
+// rowFields maps each field to the name of its column. Fields beyond the last column are keyed by their 1-based
+// position, and a column name that appears more than once keeps the last of its fields.
+func rowFields(fields []string, columns []string) map[string]string {
+	m := make(map[string]string, len(fields))
+	for i, field := range fields {
+		if i < len(columns) {
+			m[columns[i]] = field
+		} else {
+			m[strconv.Itoa(i+1)] = field
+		}
+	}
+	return m
+}
+
+func createMessage(row string, index int, event *event.FileUploaded, startTime time.Time, datasetID string, dialect Dialect, columns []string) (*sarama.ProducerMessage, error) {
 
 	message := RowMessage{
-		Index:     index,
-		Row:       row,
-		S3URL:     event.GetURL(),
-		StartTime: startTime.UTC().Unix(),
-		DatasetID: datasetID,
-		RowID:     uuid.NewV4().String(),
+		Index:         index,
+		S3URL:         event.GetURL(),
+		StartTime:     startTime.UTC().Unix(),
+		DatasetID:     datasetID,
+		RowID:         newRowID(datasetID, index),
+		ArchiveMember: event.ArchiveMember,
+	}
+	switch config.RowFormat {
+	case RowFormatMap:
+		message.Fields = rowFields(splitFields(row, dialect), columns)
+	case RowFormatDimensions:
+		message.Row = row
+		message.Observation = newObservation(splitFields(row, dialect))
+	default:
+		message.Row = row
 	}
 
 	messageJSON, err := json.Marshal(message)
@@ -146,17 +503,20 @@ func createMessage(row string, index int, event *event.FileUploaded, startTime t
 	if err != nil {
 		log.Error(err, log.Data{
 			"details": "Could not create the json representation of message",
-			"message": messageJSON,
 		})
-		panic(err)
+		return nil, err
+	}
+
+	topic := config.RowTopicName
+	if len(event.Topic) > 0 {
+		topic = event.Topic
 	}
 
-	strTime := strconv.Itoa(int(time.Now().Unix()))
 	producerMsg := &sarama.ProducerMessage{
-		Topic: config.RowTopicName,
-		Key:   sarama.StringEncoder(strTime),
+		Topic: topic,
+		Key:   rowKey(datasetID, row, dialect),
 		Value: sarama.ByteEncoder(messageJSON),
 	}
 
-	return producerMsg
+	return producerMsg, nil
 }
@@ -1,15 +1,21 @@
 package splitter_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf16"
 
 	"github.com/ONSdigital/dp-csv-splitter/config"
 	"github.com/ONSdigital/dp-csv-splitter/message/event"
+	"github.com/ONSdigital/dp-csv-splitter/source"
 	"github.com/ONSdigital/dp-csv-splitter/splitter"
 	"github.com/Shopify/sarama"
 	. "github.com/smartystreets/goconvey/convey"
@@ -19,14 +25,20 @@ import (
 var exampleHeaderLine string = "Observation,Data_Marking,Statistical_Unit_Eng,Statistical_Unit_Cym,Measure_Type_Eng,Measure_Type_Cym,Observation_Type,Empty,Obs_Type_Value,Unit_Multiplier,Unit_Of_Measure_Eng,Unit_Of_Measure_Cym,Confidentuality,Empty1,Geographic_Area,Empty2,Empty3,Time_Dim_Item_ID,Time_Dim_Item_Label_Eng,Time_Dim_Item_Label_Cym,Time_Type,Empty4,Statistical_Population_ID,Statistical_Population_Label_Eng,Statistical_Population_Label_Cym,CDID,CDIDDescrip,Empty5,Empty6,Empty7,Empty8,Empty9,Empty10,Empty11,Empty12,Dim_ID_1,dimension_Label_Eng_1,dimension_Label_Cym_1,Dim_Item_ID_1,dimension_Item_Label_Eng_1,dimension_Item_Label_Cym_1,Is_Total_1,Is_Sub_Total_1,Dim_ID_2,dimension_Label_Eng_2,dimension_Label_Cym_2,Dim_Item_ID_2,dimension_Item_Label_Eng_2,dimension_Item_Label_Cym_2,Is_Total_2,Is_Sub_Total_2\n"
 var exampleCsvLine string = "153223,,Person,,Count,,,,,,,,,,K04000001,,,,,,,,,,,,,,,,,,,,,Sex,Sex,,All categories: Sex,All categories: Sex,,,,Age,Age,,All categories: Age 16 and over,All categories: Age 16 and over,,,,Residence Type,Residence Type,,All categories: Residence Type,All categories: Residence Type,,,"
 
+var defaultCheckpoints = splitter.Checkpoints
+
 type MockProducer struct {
 	singleMessageInvocations    []*sarama.ProducerMessage
 	multipleMessagesInvocations [][]*sarama.ProducerMessage
+	invocationOrder             []string
 	throwError                  bool
+	// failBatchesAfter the number of batches sent successfully before SendMessages fails, or 0 to never fail.
+	failBatchesAfter int
 }
 
 func (mock *MockProducer) SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
 	mock.singleMessageInvocations = append(mock.singleMessageInvocations, msg)
+	mock.invocationOrder = append(mock.invocationOrder, msg.Topic)
 	if mock.throwError {
 		return 0, 0, errors.New("Mock error sending message")
 	}
@@ -35,7 +47,8 @@ func (mock *MockProducer) SendMessage(msg *sarama.ProducerMessage) (partition in
 
 func (mock *MockProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
 	mock.multipleMessagesInvocations = append(mock.multipleMessagesInvocations, msgs)
-	if mock.throwError {
+	mock.invocationOrder = append(mock.invocationOrder, config.RowTopicName)
+	if mock.throwError || (mock.failBatchesAfter > 0 && len(mock.multipleMessagesInvocations) > mock.failBatchesAfter) {
 		return errors.New("Mock error sending messages")
 	}
 	return nil
@@ -63,7 +76,8 @@ func TestProcess(t *testing.T) {
 		var processor = splitter.NewCSVProcessor()
 
 		Convey("When the processor is called", func() {
-			processor.Process(reader, uploadEvent, startTime, datasetID)
+			err := processor.Process(reader, uploadEvent, startTime, datasetID, "")
+			So(err, ShouldBeNil)
 
 			So(len(mockProducer.multipleMessagesInvocations), ShouldEqual, 1)
 			So(len(mockProducer.multipleMessagesInvocations[0]), ShouldEqual, 2)
@@ -82,14 +96,392 @@ func TestProcess(t *testing.T) {
 				So(err, ShouldBeNil)
 			}
 
-			So(len(mockProducer.singleMessageInvocations), ShouldEqual, 1)
-			producerMessage := mockProducer.singleMessageInvocations[0]
+			So(len(mockProducer.singleMessageInvocations), ShouldEqual, 2)
+			startedMessage := extractStartedMessage(mockProducer.singleMessageInvocations[0])
+			So(startedMessage.DatasetID, ShouldEqual, datasetID)
+			So(startedMessage.Status, ShouldEqual, splitter.StatusStarted)
+			So(startedMessage.Header, ShouldResemble, strings.Split(strings.TrimSuffix(exampleHeaderLine, "\n"), ","))
+			So(startedMessage.ColumnCount, ShouldEqual, 51)
+			So(startedMessage.S3URL, ShouldEqual, url.String())
+
+			producerMessage := mockProducer.singleMessageInvocations[1]
 			So(producerMessage.Topic, ShouldEqual, config.DatasetTopicName)
-			datasetMessage := extractDatasetMessage(mockProducer.singleMessageInvocations[0])
+			datasetMessage := extractDatasetMessage(producerMessage)
 			So(datasetMessage.DatasetID, ShouldEqual, datasetID)
 			So(datasetMessage.TotalRows, ShouldEqual, 2)
+			So(datasetMessage.Status, ShouldEqual, splitter.StatusComplete)
+			So(datasetMessage.S3URL, ShouldEqual, url.String())
+			So(mockProducer.invocationOrder, ShouldResemble, []string{config.DatasetTopicName, config.RowTopicName, config.DatasetTopicName})
+		})
+
+	})
+
+	Convey("Given started events are turned off", t, func() {
+		defaultSendStartedEvents := config.SendStartedEvents
+		config.SendStartedEvents = false
+		Reset(func() { config.SendStartedEvents = defaultSendStartedEvents })
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+
+		Convey("When the processor is called", func() {
+			reader := strings.NewReader(exampleHeaderLine + exampleCsvLine)
+			So(splitter.NewCSVProcessor().Process(reader, uploadEvent, startTime, datasetID, ""), ShouldBeNil)
+
+			Convey("Then only the completion message is sent to the dataset topic", func() {
+				So(len(mockProducer.singleMessageInvocations), ShouldEqual, 1)
+				So(extractDatasetMessage(mockProducer.singleMessageInvocations[0]).Status, ShouldEqual, splitter.StatusComplete)
+				So(mockProducer.invocationOrder, ShouldResemble, []string{config.RowTopicName, config.DatasetTopicName})
+			})
+		})
+	})
+
+	Convey("Given a CSV row with a quoted field spanning multiple lines", t, func() {
+		multiLineRow := "153223,\"Footnote line one\nline two\",Person"
+		reader := strings.NewReader(exampleHeaderLine + multiLineRow + "\n" + exampleCsvLine)
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+
+		Convey("When the processor is called", func() {
+			splitter.NewCSVProcessor().Process(reader, uploadEvent, startTime, datasetID, "")
+
+			Convey("Then the multi-line record is sent as a single row", func() {
+				So(len(mockProducer.multipleMessagesInvocations[0]), ShouldEqual, 2)
+				first := extractRowMessage(mockProducer.multipleMessagesInvocations[0][0])
+				So(first.Index, ShouldEqual, 0)
+				So(first.Row, ShouldEqual, multiLineRow)
+				second := extractRowMessage(mockProducer.multipleMessagesInvocations[0][1])
+				So(second.Index, ShouldEqual, 1)
+				So(second.Row, ShouldEqual, exampleCsvLine)
+			})
+		})
+	})
+
+	Convey("Given a CSV with a row over the maximum row size", t, func() {
+		defaultMaxRowSize, defaultBatchSize := config.MaxRowSize, config.BatchSize
+		config.MaxRowSize, config.BatchSize = len(exampleHeaderLine), 1
+		longRow := exampleCsvLine + strings.Repeat(",", len(exampleHeaderLine))
+		reader := strings.NewReader(exampleHeaderLine + exampleCsvLine + "\n" + longRow + "\n" + exampleCsvLine)
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(reader, uploadEvent, startTime, datasetID, "")
+			config.MaxRowSize, config.BatchSize = defaultMaxRowSize, defaultBatchSize
+
+			Convey("Then the split completes", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("And the rows either side of it are sent", func() {
+				So(len(mockProducer.multipleMessagesInvocations[0]), ShouldEqual, 1)
+				So(extractRowMessage(mockProducer.multipleMessagesInvocations[0][0]).Index, ShouldEqual, 0)
+				So(len(mockProducer.multipleMessagesInvocations[1]), ShouldEqual, 1)
+				So(extractRowMessage(mockProducer.multipleMessagesInvocations[1][0]).Index, ShouldEqual, 2)
+			})
+
+			Convey("And the long row is sent to the dead letter topic", func() {
+				So(len(mockProducer.singleMessageInvocations), ShouldEqual, 3)
+				producerMessage := mockProducer.singleMessageInvocations[1]
+				So(producerMessage.Topic, ShouldEqual, config.RowDeadLetterTopicName)
+				var rejected splitter.RejectedRow
+				value, _ := producerMessage.Value.Encode()
+				json.Unmarshal(value, &rejected)
+				So(rejected.DatasetID, ShouldEqual, datasetID)
+				So(rejected.Index, ShouldEqual, 1)
+				So(string(rejected.Raw), ShouldEqual, longRow[:len(exampleHeaderLine)])
+				So(rejected.ErrorCode, ShouldEqual, splitter.RowErrorTooLong)
+				So(rejected.Message, ShouldNotBeEmpty)
+			})
+
+			Convey("And the dataset event counts the accepted and rejected rows", func() {
+				datasetMessage := extractDatasetMessage(mockProducer.singleMessageInvocations[2])
+				So(datasetMessage.Status, ShouldEqual, splitter.StatusComplete)
+				So(datasetMessage.AcceptedRows, ShouldEqual, 2)
+				So(datasetMessage.RejectedRows, ShouldEqual, 1)
+				So(datasetMessage.LastIndex, ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given a CSV with a row over the maximum row size and a producer that fails after the first batch", t, func() {
+		defaultMaxRowSize, defaultBatchSize := config.MaxRowSize, config.BatchSize
+		config.MaxRowSize, config.BatchSize = len(exampleHeaderLine), 1
+		longRow := exampleCsvLine + strings.Repeat(",", len(exampleHeaderLine))
+		reader := strings.NewReader(exampleHeaderLine + exampleCsvLine + "\n" + longRow + "\n" + exampleCsvLine)
+		mockProducer := &MockProducer{failBatchesAfter: 1}
+		splitter.Producer = mockProducer
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(reader, uploadEvent, startTime, datasetID, "")
+			config.MaxRowSize, config.BatchSize = defaultMaxRowSize, defaultBatchSize
+
+			Convey("Then a split error is returned", func() {
+				So(err, ShouldHaveSameTypeAs, &splitter.SplitError{})
+			})
+
+			Convey("And the failed dataset event counts the accepted and rejected rows", func() {
+				So(len(mockProducer.singleMessageInvocations), ShouldEqual, 3)
+				datasetMessage := extractDatasetMessage(mockProducer.singleMessageInvocations[2])
+				So(datasetMessage.Status, ShouldEqual, splitter.StatusFailed)
+				So(datasetMessage.TotalRows, ShouldEqual, 1)
+				So(datasetMessage.AcceptedRows, ShouldEqual, 1)
+				So(datasetMessage.RejectedRows, ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a mock producer that fails to send messages", t, func() {
+		reader := strings.NewReader(exampleHeaderLine + exampleCsvLine)
+		mockProducer := &MockProducer{throwError: true}
+		splitter.Producer = mockProducer
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(reader, uploadEvent, startTime, datasetID, "")
+
+			Convey("Then a split error is returned", func() {
+				So(err, ShouldHaveSameTypeAs, &splitter.SplitError{})
+				So(err.(*splitter.SplitError).LastIndex, ShouldEqual, -1)
+			})
+
+			Convey("And a failed dataset event is sent instead of a completion event", func() {
+				So(len(mockProducer.singleMessageInvocations), ShouldEqual, 2)
+				datasetMessage := extractDatasetMessage(mockProducer.singleMessageInvocations[1])
+				So(datasetMessage.Status, ShouldEqual, splitter.StatusFailed)
+				So(datasetMessage.TotalRows, ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given a split interrupted after its first row", t, func() {
+		dir, _ := ioutil.TempDir("", "checkpoints")
+		defer os.RemoveAll(dir)
+		store, _ := splitter.NewFileCheckpointStore(dir)
+		splitter.Checkpoints = store
+		defer func() { splitter.Checkpoints = defaultCheckpoints }()
+
+		defaultBatchSize := config.BatchSize
+		config.BatchSize = 1
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+
+		header := exampleHeaderLine
+		secondRow := strings.Replace(exampleCsvLine, "153223", "153224", 1)
+		file := header + exampleCsvLine + "\n" + secondRow + "\n"
+
+		Convey("When the split is resumed from the saved checkpoint", func() {
+			processor := splitter.NewCSVProcessor()
+			err := processor.Process(strings.NewReader(header+exampleCsvLine+"\n"), uploadEvent, startTime, datasetID, "")
+			So(err, ShouldBeNil)
+
+			checkpoint := &splitter.Checkpoint{DatasetID: datasetID, URL: url.String(), Index: 1, Offset: int64(len(header + exampleCsvLine + "\n"))}
+			So(store.Save(checkpoint), ShouldBeNil)
+			mockProducer.multipleMessagesInvocations = nil
+
+			err = processor.Resume(strings.NewReader(file[checkpoint.Offset:]), uploadEvent, startTime, checkpoint)
+			config.BatchSize = defaultBatchSize
+
+			Convey("Then the remaining rows are sent with the same dataset ID and continuing index", func() {
+				So(err, ShouldBeNil)
+				rowMessage := extractRowMessage(mockProducer.multipleMessagesInvocations[0][0])
+				So(rowMessage.DatasetID, ShouldEqual, datasetID)
+				So(rowMessage.Index, ShouldEqual, 1)
+				So(rowMessage.Row, ShouldEqual, secondRow)
+
+				datasetMessage := extractDatasetMessage(mockProducer.singleMessageInvocations[len(mockProducer.singleMessageInvocations)-1])
+				So(datasetMessage.TotalRows, ShouldEqual, 2)
+			})
+
+			Convey("And the checkpoint is removed once the split completes", func() {
+				checkpoint, err := store.Get(url.String())
+				So(err, ShouldBeNil)
+				So(checkpoint, ShouldBeNil)
+			})
 		})
+	})
+
+	Convey("Given deterministic IDs are enabled", t, func() {
+		config.DeterministicIDs = true
+		defer func() { config.DeterministicIDs = false }()
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+		processor := splitter.NewCSVProcessor()
+
+		Convey("When the same file is processed twice", func() {
+			processor.Process(strings.NewReader(exampleHeaderLine+exampleCsvLine), uploadEvent, startTime, datasetID, "")
+			processor.Process(strings.NewReader(exampleHeaderLine+exampleCsvLine), uploadEvent, startTime, datasetID, "")
+
+			Convey("Then the row IDs are identical", func() {
+				first := extractRowMessage(mockProducer.multipleMessagesInvocations[0][0])
+				second := extractRowMessage(mockProducer.multipleMessagesInvocations[1][0])
+				So(first.RowID, ShouldEqual, second.RowID)
+			})
+		})
+	})
+
+	Convey("Given each partition key strategy", t, func() {
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+		processor := splitter.NewCSVProcessor()
+		otherObservation := strings.Replace(exampleCsvLine, "153223", "153224", 1)
+		file := exampleHeaderLine + exampleCsvLine + "\n" + otherObservation
+
+		Convey("When keyed by dataset", func() {
+			processor.Process(strings.NewReader(file), uploadEvent, startTime, datasetID, "")
 
+			Convey("Then rows and the dataset event are keyed with the dataset ID", func() {
+				So(mockProducer.multipleMessagesInvocations[0][0].Key, ShouldEqual, sarama.StringEncoder(datasetID))
+				So(mockProducer.singleMessageInvocations[0].Key, ShouldEqual, sarama.StringEncoder(datasetID))
+			})
+		})
+
+		Convey("When keyed by dimensions", func() {
+			config.PartitionKey = splitter.KeyByDimensions
+			processor.Process(strings.NewReader(file), uploadEvent, startTime, datasetID, "")
+			config.PartitionKey = splitter.KeyByDataset
+
+			Convey("Then rows with the same dimensions share a key", func() {
+				first := mockProducer.multipleMessagesInvocations[0][0].Key
+				So(first, ShouldNotEqual, sarama.StringEncoder(datasetID))
+				So(mockProducer.multipleMessagesInvocations[0][1].Key, ShouldEqual, first)
+			})
+		})
+
+		Convey("When keyed round robin", func() {
+			config.PartitionKey = splitter.KeyRoundRobin
+			processor.Process(strings.NewReader(file), uploadEvent, startTime, datasetID, "")
+			config.PartitionKey = splitter.KeyByDataset
+
+			Convey("Then no messages are keyed", func() {
+				So(mockProducer.multipleMessagesInvocations[0][0].Key, ShouldBeNil)
+				So(mockProducer.singleMessageInvocations[0].Key, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a UTF-16LE file with a byte order mark", t, func() {
+		var file []byte
+		file = append(file, 0xff, 0xfe)
+		for _, unit := range utf16.Encode([]rune("Observation,Label_Cym\n153223,Gŵyl\n")) {
+			file = append(file, byte(unit), byte(unit>>8))
+		}
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(bytes.NewReader(file), uploadEvent, startTime, datasetID, "")
+
+			Convey("Then the rows are published as UTF-8", func() {
+				So(err, ShouldBeNil)
+				rowMessage := extractRowMessage(mockProducer.multipleMessagesInvocations[0][0])
+				So(rowMessage.Row, ShouldEqual, "153223,Gŵyl")
+			})
+		})
+	})
+
+	Convey("Given a semicolon delimited file with single quoted fields", t, func() {
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+		file := "'Observation';'Label'\n153223;'line one\nline two'\n"
+
+		Convey("When the processor is called without a dialect", func() {
+			err := splitter.NewCSVProcessor().Process(strings.NewReader(file), uploadEvent, startTime, datasetID, "")
+
+			Convey("Then the dialect is sniffed from the header and reported in the dataset event", func() {
+				So(err, ShouldBeNil)
+				So(len(mockProducer.multipleMessagesInvocations[0]), ShouldEqual, 1)
+				datasetMessage := extractDatasetMessage(mockProducer.singleMessageInvocations[1])
+				So(*datasetMessage.Dialect, ShouldResemble, splitter.Dialect{Delimiter: ";", Quote: "'"})
+			})
+		})
+	})
+
+	Convey("Given rows are sent as maps", t, func() {
+		config.RowFormat = splitter.RowFormatMap
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+		file := "Observation,Data_Marking,Label\n153223,,\"Sex, all\"\n"
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(strings.NewReader(file), uploadEvent, startTime, datasetID, "")
+			config.RowFormat = splitter.RowFormatRaw
+
+			Convey("Then each row's fields are keyed by column name", func() {
+				So(err, ShouldBeNil)
+				rowMessage := extractRowMessage(mockProducer.multipleMessagesInvocations[0][0])
+				So(rowMessage.Row, ShouldBeEmpty)
+				So(rowMessage.Fields, ShouldResemble, map[string]string{
+					"Observation":  "153223",
+					"Data_Marking": "",
+					"Label":        "Sex, all",
+				})
+			})
+		})
+	})
+
+	Convey("Given the sample file is validated against the v4 schema", t, func() {
+		config.Schema = splitter.SchemaV4
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+		file, _ := os.Open("../sample_csv/Open-Data-small.csv")
+		defer file.Close()
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(file, uploadEvent, startTime, datasetID, "")
+			config.Schema = splitter.SchemaNone
+
+			Convey("Then the row that does not match the schema is not sent", func() {
+				So(err, ShouldBeNil)
+				datasetMessage := extractDatasetMessage(mockProducer.singleMessageInvocations[len(mockProducer.singleMessageInvocations)-1])
+				So(datasetMessage.Status, ShouldEqual, splitter.StatusComplete)
+				So(datasetMessage.TotalRows, ShouldEqual, 276)
+				So(datasetMessage.RejectedRows, ShouldEqual, 1)
+				So(datasetMessage.LastIndex, ShouldEqual, 276)
+			})
+		})
+	})
+
+	Convey("Given a file whose header does not match the v4 schema", t, func() {
+		config.Schema = splitter.SchemaV4
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(strings.NewReader("a,b\n1,2\n"), uploadEvent, startTime, datasetID, "")
+			config.Schema = splitter.SchemaNone
+
+			Convey("Then the split fails before any rows are sent", func() {
+				So(err, ShouldHaveSameTypeAs, &splitter.SplitError{})
+				So(err.(*splitter.SplitError).Err, ShouldHaveSameTypeAs, &splitter.SchemaError{})
+				So(mockProducer.multipleMessagesInvocations, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given rows are sent with their dimensions", t, func() {
+		config.RowFormat = splitter.RowFormatDimensions
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+		records := readSampleCSV()
+		row := strings.Join(records[1], ",")
+		file := strings.Join(records[0], ",") + "\n" + row + "\n"
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(strings.NewReader(file), uploadEvent, startTime, datasetID, "")
+			config.RowFormat = splitter.RowFormatRaw
+
+			Convey("Then the row is sent with its structured observation", func() {
+				So(err, ShouldBeNil)
+				rowMessage := extractRowMessage(mockProducer.multipleMessagesInvocations[0][0])
+				So(rowMessage.Row, ShouldEqual, row)
+				So(rowMessage.Observation.Value, ShouldEqual, "36929")
+				So(rowMessage.Observation.Geography, ShouldBeNil)
+				So(*rowMessage.Observation.Time, ShouldResemble, splitter.Time{ID: "2014", LabelEng: "2014", Type: "Year"})
+				So(rowMessage.Observation.Dimensions, ShouldResemble, []splitter.Dimension{
+					{ID: "NACE", LabelEng: "NACE", ItemID: "08", ItemLabelEng: "08 - Other mining and quarrying"},
+					{ID: "Prodcom Elements", LabelEng: "Prodcom Elements", ItemID: "UK manufacturer sales ID", ItemLabelEng: "UK manufacturer sales LABEL"},
+				})
+			})
+		})
 	})
 
 }
@@ -101,6 +493,15 @@ func extractRowMessage(producerMessage *sarama.ProducerMessage) *splitter.RowMes
 
 	return message
 }
+
+func extractStartedMessage(producerMessage *sarama.ProducerMessage) *splitter.DatasetStartedEvent {
+	var message *splitter.DatasetStartedEvent
+	val, _ := producerMessage.Value.Encode()
+	json.Unmarshal(val, &message)
+
+	return message
+}
+
 func extractDatasetMessage(producerMessage *sarama.ProducerMessage) *splitter.DatasetSplitEvent {
 	var message *splitter.DatasetSplitEvent
 	val, _ := producerMessage.Value.Encode()
@@ -108,3 +509,107 @@ func extractDatasetMessage(producerMessage *sarama.ProducerMessage) *splitter.Da
 
 	return message
 }
+
+func TestProcess_Jobs(t *testing.T) {
+	jobsURL, _ := url.Parse("s3://bucket/dir/jobs.csv")
+	uploadEvent := &event.FileUploaded{S3URL: event.NewS3URL(jobsURL), Time: time.Now().UTC().Unix()}
+
+	Convey("Given a CSV with two rows", t, func() {
+		csv := exampleHeaderLine + exampleCsvLine + "\n" + exampleCsvLine
+		reader := strings.NewReader(csv)
+
+		Convey("When the split of a file opened from a source succeeds", func() {
+			dir, _ := ioutil.TempDir("", "jobs")
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "jobs.csv")
+			ioutil.WriteFile(path, []byte(csv), 0644)
+			fileURL, _ := url.Parse("file://" + path)
+			sources := source.NewRegistry()
+			sources.Register(source.NewFileSource(), "file")
+			file, _ := sources.Open(fileURL, 0)
+			defer file.Close()
+
+			splitter.Producer = &MockProducer{}
+			err := splitter.NewCSVProcessor().Process(file, uploadEvent, time.Now(), "job-complete", "")
+			So(err, ShouldBeNil)
+
+			Convey("Then its job is complete with every row published", func() {
+				job, ok := splitter.Jobs.Get("job-complete")
+				So(ok, ShouldBeTrue)
+				So(job.SourceURL, ShouldEqual, jobsURL.String())
+				So(job.State, ShouldEqual, splitter.JobComplete)
+				So(job.RowsPublished, ShouldEqual, 2)
+				So(job.Batches, ShouldEqual, 1)
+				So(job.StartTime, ShouldNotBeNil)
+				So(job.EndTime, ShouldNotBeNil)
+				So(job.LastError, ShouldBeEmpty)
+				So(job.Size, ShouldEqual, len(csv))
+				So(job.BytesRead, ShouldEqual, len(exampleHeaderLine))
+			})
+		})
+
+		Convey("When the rows cannot be sent", func() {
+			splitter.Producer = &MockProducer{throwError: true}
+			err := splitter.NewCSVProcessor().Process(reader, uploadEvent, time.Now(), "job-failed", "")
+			So(err, ShouldNotBeNil)
+
+			Convey("Then its job has failed with the error", func() {
+				job, ok := splitter.Jobs.Get("job-failed")
+				So(ok, ShouldBeTrue)
+				So(job.State, ShouldEqual, splitter.JobFailed)
+				So(job.RowsPublished, ShouldEqual, 0)
+				So(job.EndTime, ShouldNotBeNil)
+				So(job.LastError, ShouldEqual, err.Error())
+			})
+		})
+	})
+}
+
+func TestProcess_EventOverrides(t *testing.T) {
+	url, _ := url.Parse("s3://bucket/dir/overrides.csv")
+
+	Convey("Given an event that overrides the row topic and batch size", t, func() {
+		uploadEvent := &event.FileUploaded{S3URL: event.NewS3URL(url), Time: time.Now().UTC().Unix(), Topic: "override", BatchSize: 1}
+		reader := strings.NewReader(exampleHeaderLine + exampleCsvLine + "\n" + exampleCsvLine)
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(reader, uploadEvent, time.Now(), "overrides", "")
+			So(err, ShouldBeNil)
+
+			Convey("Then each row is sent to the topic in its own batch", func() {
+				batches := mockProducer.multipleMessagesInvocations
+				So(len(batches), ShouldBeGreaterThanOrEqualTo, 2)
+				for _, msgs := range batches[:2] {
+					So(msgs, ShouldHaveLength, 1)
+					So(msgs[0].Topic, ShouldEqual, "override")
+				}
+			})
+		})
+	})
+}
+
+func TestProcess_SingleQuotes(t *testing.T) {
+	url, _ := url.Parse("s3://bucket/dir/single-quotes.csv")
+
+	Convey("Given a file quoted with single quotes with apostrophes in unquoted fields", t, func() {
+		uploadEvent := &event.FileUploaded{S3URL: event.NewS3URL(url), Time: time.Now().UTC().Unix(), Quote: "'"}
+		reader := strings.NewReader("Observation,Label\n1,Children's\n2,'Plant, y byd'\n3,Plentyn's\n")
+		mockProducer := &MockProducer{}
+		splitter.Producer = mockProducer
+
+		Convey("When the processor is called", func() {
+			err := splitter.NewCSVProcessor().Process(reader, uploadEvent, time.Now(), "single-quotes", "")
+			So(err, ShouldBeNil)
+
+			Convey("Then each line is sent as its own row", func() {
+				msgs := mockProducer.multipleMessagesInvocations[0]
+				So(msgs, ShouldHaveLength, 3)
+				So(extractRowMessage(msgs[0]).Row, ShouldEqual, "1,Children's")
+				So(extractRowMessage(msgs[1]).Row, ShouldEqual, "2,'Plant, y byd'")
+				So(extractRowMessage(msgs[2]).Row, ShouldEqual, "3,Plentyn's")
+			})
+		})
+	})
+}
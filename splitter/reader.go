@@ -0,0 +1,180 @@
+package splitter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnterminatedQuote is returned when the input ends inside a quoted field.
+var ErrUnterminatedQuote = errors.New("csv record ends inside a quoted field")
+
+// ErrRowTooLong is returned when a record is larger than the maximum row size of the reader.
+type ErrRowTooLong struct {
+	MaxRowSize int
+}
+
+func (e *ErrRowTooLong) Error() string {
+	return fmt.Sprintf("csv record exceeds the maximum row size of %d bytes", e.MaxRowSize)
+}
+
+// RecordReader reads RFC 4180 records from a CSV stream. Unlike a line scanner a quoted field may contain line
+// breaks, so a single record can span several physical lines. The original text of each record is returned untouched.
+type RecordReader struct {
+	reader     *bufio.Reader
+	maxRowSize int
+	quote      byte
+	delimiter  byte
+	offset     int64
+}
+
+// NewRecordReader create a new RecordReader reading from r. Records are read in chunks so rows of any length up to
+// maxRowSize bytes are supported. A maxRowSize of zero or less means no limit. Fields are quoted with '"' and
+// delimited by ',' unless changed with SetQuote and SetDelimiter.
+func NewRecordReader(r io.Reader, maxRowSize int) *RecordReader {
+	return &RecordReader{reader: bufio.NewReader(r), maxRowSize: maxRowSize, quote: '"', delimiter: ','}
+}
+
+// SetQuote sets the character used to quote fields in the records that follow.
+func (rr *RecordReader) SetQuote(quote byte) {
+	rr.quote = quote
+}
+
+// SetDelimiter sets the character that separates fields in the records that follow. Only a quote at the start of a
+// field opens a quoted field, so the reader needs to know where fields start.
+func (rr *RecordReader) SetDelimiter(delimiter byte) {
+	rr.delimiter = delimiter
+}
+
+// Read returns the text of the next record without its line terminator. Empty lines are skipped. io.EOF is
+// returned when there are no more records. A record that is too long or ends inside a quoted field is returned along
+// with the error, cut short at the maximum row size, and the reader moves on to the next record.
+func (rr *RecordReader) Read() (string, error) {
+	for {
+		record, err := rr.readRecord()
+		if err == io.EOF {
+			return "", err
+		}
+		if err != nil {
+			return string(record), err
+		}
+		if len(record) > 0 {
+			return string(record), nil
+		}
+	}
+}
+
+// Offset returns the number of bytes consumed from the input by the records read so far.
+func (rr *RecordReader) Offset() int64 {
+	return rr.offset
+}
+
+func (rr *RecordReader) readRecord() ([]byte, error) {
+	var record []byte
+	state := fieldStart
+	tooLong := false
+
+	for {
+		// ReadSlice returns at most a buffer's worth of data, so long lines are accumulated a chunk at a time.
+		chunk, err := rr.reader.ReadSlice('\n')
+		rr.offset += int64(len(chunk))
+		state = scanQuotes(chunk, rr.quote, rr.delimiter, state)
+		inQuotes := state == inQuotedField
+
+		// Allow for the line terminator, which is not counted against the limit. The rest of a record that is too long
+		// is read and discarded so the next read starts at the following record.
+		if rr.maxRowSize > 0 && len(record)+len(chunk) > rr.maxRowSize+2 {
+			if keep := rr.maxRowSize - len(record); !tooLong && keep > 0 {
+				record = append(record, chunk[:keep]...)
+			}
+			tooLong = true
+		} else if !tooLong {
+			record = append(record, chunk...)
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF:
+			if len(record) == 0 {
+				return nil, io.EOF
+			}
+			if inQuotes {
+				return record, ErrUnterminatedQuote
+			}
+			return rr.complete(record, tooLong)
+		case err != nil:
+			return nil, err
+		case !inQuotes:
+			return rr.complete(record, tooLong)
+		}
+	}
+}
+
+func (rr *RecordReader) complete(record []byte, tooLong bool) ([]byte, error) {
+	if !tooLong {
+		record = trimLineEnding(record)
+	}
+	if tooLong || (rr.maxRowSize > 0 && len(record) > rr.maxRowSize) {
+		return record[:minInt(len(record), rr.maxRowSize)], &ErrRowTooLong{MaxRowSize: rr.maxRowSize}
+	}
+	return record, nil
+}
+
+// quoteState where the reader is within a record, as far as quoting is concerned.
+type quoteState int
+
+const (
+	// fieldStart at the start of a field, where a quote opens a quoted field.
+	fieldStart quoteState = iota
+	// inUnquotedField within an unquoted field, where a quote is a literal character.
+	inUnquotedField
+	// inQuotedField within a quoted field, where delimiters and line breaks are part of the field.
+	inQuotedField
+	// afterQuote just after a quote in a quoted field, which either closes the field or escapes a second quote.
+	afterQuote
+)
+
+// scanQuotes returns the quote state after reading b from state. It follows the same rules as splitFields: only a
+// quote at the start of a field opens a quoted field, a doubled quote inside one is an escaped literal, and any other
+// quote is kept as part of the field.
+func scanQuotes(b []byte, quote byte, delimiter byte, state quoteState) quoteState {
+	for _, c := range b {
+		switch state {
+		case inQuotedField:
+			if c == quote {
+				state = afterQuote
+			}
+		case afterQuote:
+			switch c {
+			case quote:
+				state = inQuotedField
+			case delimiter, '\n':
+				state = fieldStart
+			default:
+				state = inUnquotedField
+			}
+		default:
+			switch {
+			case c == delimiter || c == '\n':
+				state = fieldStart
+			case c == quote && state == fieldStart:
+				state = inQuotedField
+			default:
+				state = inUnquotedField
+			}
+		}
+	}
+	return state
+}
+
+func trimLineEnding(b []byte) []byte {
+	if len(b) > 0 && b[len(b)-1] == '\n' {
+		b = b[:len(b)-1]
+	}
+	if len(b) > 0 && b[len(b)-1] == '\r' {
+		b = b[:len(b)-1]
+	}
+	return b
+}
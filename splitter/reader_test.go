@@ -0,0 +1,144 @@
+package splitter_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordReader_Read(t *testing.T) {
+
+	Convey("Given a CSV containing a quoted field with a line break", t, func() {
+		multiLineRecord := "1,\"Footnote line one\nline two\",K04000001"
+		reader := splitter.NewRecordReader(strings.NewReader("a,b,c\r\n"+multiLineRecord+"\n2,\"say \"\"hi\"\"\",x\n"), 0)
+
+		Convey("When the records are read", func() {
+			header, err := reader.Read()
+			So(err, ShouldBeNil)
+			So(header, ShouldEqual, "a,b,c")
+
+			first, err := reader.Read()
+			So(err, ShouldBeNil)
+			So(first, ShouldEqual, multiLineRecord)
+
+			second, err := reader.Read()
+			So(err, ShouldBeNil)
+			So(second, ShouldEqual, "2,\"say \"\"hi\"\"\",x")
+
+			_, err = reader.Read()
+			So(err, ShouldEqual, io.EOF)
+		})
+	})
+
+	Convey("Given a CSV with a stray quote inside an unquoted field", t, func() {
+		reader := splitter.NewRecordReader(strings.NewReader("1,5\" screen,x\n2,y,z\n3,\"a\"\"b\",c\n"), 0)
+
+		Convey("When the records are read", func() {
+			Convey("Then the quote is a literal and does not join the following lines", func() {
+				first, err := reader.Read()
+				So(err, ShouldBeNil)
+				So(first, ShouldEqual, "1,5\" screen,x")
+
+				second, err := reader.Read()
+				So(err, ShouldBeNil)
+				So(second, ShouldEqual, "2,y,z")
+
+				third, err := reader.Read()
+				So(err, ShouldBeNil)
+				So(third, ShouldEqual, "3,\"a\"\"b\",c")
+
+				_, err = reader.Read()
+				So(err, ShouldEqual, io.EOF)
+			})
+		})
+	})
+
+	Convey("Given a CSV quoted with single quotes and apostrophes in unquoted fields", t, func() {
+		reader := splitter.NewRecordReader(strings.NewReader("1\tChildren's\tPlant y byd\n2\t'Ysgol y Plant'\tPlentyn's\n3\t'it''s\nquoted'\tx\n"), 0)
+		reader.SetQuote('\'')
+		reader.SetDelimiter('\t')
+
+		Convey("When the records are read", func() {
+			Convey("Then only the quotes at the start of a field open a quoted field", func() {
+				first, err := reader.Read()
+				So(err, ShouldBeNil)
+				So(first, ShouldEqual, "1\tChildren's\tPlant y byd")
+
+				second, err := reader.Read()
+				So(err, ShouldBeNil)
+				So(second, ShouldEqual, "2\t'Ysgol y Plant'\tPlentyn's")
+
+				third, err := reader.Read()
+				So(err, ShouldBeNil)
+				So(third, ShouldEqual, "3\t'it''s\nquoted'\tx")
+
+				_, err = reader.Read()
+				So(err, ShouldEqual, io.EOF)
+			})
+		})
+	})
+
+	Convey("Given a CSV that ends inside a quoted field", t, func() {
+		reader := splitter.NewRecordReader(strings.NewReader("1,\"unterminated\n"), 0)
+
+		Convey("When the record is read", func() {
+			_, err := reader.Read()
+
+			Convey("Then an error is returned", func() {
+				So(err, ShouldEqual, splitter.ErrUnterminatedQuote)
+			})
+		})
+	})
+
+	Convey("Given a row longer than the bufio buffer", t, func() {
+		longRow := strings.Repeat("a,", 50000) + "a"
+		reader := splitter.NewRecordReader(strings.NewReader(longRow+"\nb\n"), len(longRow))
+
+		Convey("When the records are read", func() {
+			first, err := reader.Read()
+			So(err, ShouldBeNil)
+			So(first, ShouldEqual, longRow)
+
+			second, err := reader.Read()
+			So(err, ShouldBeNil)
+			So(second, ShouldEqual, "b")
+		})
+	})
+
+	Convey("Given a row longer than the maximum row size", t, func() {
+		reader := splitter.NewRecordReader(strings.NewReader(strings.Repeat("a", 11)+"\nb\n"), 10)
+
+		Convey("When the record is read", func() {
+			record, err := reader.Read()
+
+			Convey("Then a row too long error is returned with the start of the record", func() {
+				So(err, ShouldHaveSameTypeAs, &splitter.ErrRowTooLong{})
+				So(record, ShouldEqual, strings.Repeat("a", 10))
+			})
+
+			Convey("And the next read returns the following record", func() {
+				next, err := reader.Read()
+				So(err, ShouldBeNil)
+				So(next, ShouldEqual, "b")
+			})
+		})
+	})
+
+	Convey("Given a row much longer than both the maximum row size and the bufio buffer", t, func() {
+		reader := splitter.NewRecordReader(strings.NewReader(strings.Repeat("a,", 50000)+"\nb\n"), 10)
+
+		Convey("When the records are read", func() {
+			_, err := reader.Read()
+			So(err, ShouldHaveSameTypeAs, &splitter.ErrRowTooLong{})
+
+			Convey("Then the rest of the long row is skipped", func() {
+				next, err := reader.Read()
+				So(err, ShouldBeNil)
+				So(next, ShouldEqual, "b")
+			})
+		})
+	})
+}
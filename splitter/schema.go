@@ -0,0 +1,196 @@
+package splitter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Schemas that rows can be validated against, set by config.Schema.
+const (
+	// SchemaNone rows are not validated.
+	SchemaNone = ""
+	// SchemaV4 the ONS Open-Data v4 observation layout.
+	SchemaV4 = "v4"
+)
+
+// ErrUnknownSchema is returned for a schema name that the splitter does not know.
+var ErrUnknownSchema = errors.New("unknown schema")
+
+// Violation a way in which a header or row does not match the schema.
+type Violation struct {
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if len(v.Column) == 0 {
+		return v.Message
+	}
+	return v.Column + ": " + v.Message
+}
+
+// SchemaError is returned when the header row of a file does not match the schema, as none of its rows can be valid.
+type SchemaError struct {
+	Schema     string
+	Violations []Violation
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("header does not match the %s schema: %s", e.Schema, joinViolations(e.Violations))
+}
+
+func joinViolations(violations []Violation) string {
+	messages := make([]string, len(violations))
+	for i, violation := range violations {
+		messages[i] = violation.String()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validator checks the header and rows of a file against a schema.
+type Validator interface {
+	// ValidateHeader checks the column names of the header row. The rows that follow are validated against them.
+	ValidateHeader(columns []string) []Violation
+	ValidateRow(fields []string) []Violation
+}
+
+// NewValidator returns a Validator for the named schema, or nil for SchemaNone.
+func NewValidator(schema string) (Validator, error) {
+	switch schema {
+	case SchemaNone:
+		return nil, nil
+	case SchemaV4:
+		return &v4Validator{}, nil
+	default:
+		return nil, ErrUnknownSchema
+	}
+}
+
+// The columns of a v4 file before its dimension groups.
+var v4Columns = []string{
+	"Observation", "Data_Marking", "Statistical_Unit_Eng", "Statistical_Unit_Cym", "Measure_Type_Eng",
+	"Measure_Type_Cym", "Observation_Type", "Empty", "Obs_Type_Value", "Unit_Multiplier", "Unit_Of_Measure_Eng",
+	"Unit_Of_Measure_Cym", "Confidentuality", "Empty1", "Geographic_Area", "Empty2", "Empty3", "Time_Dim_Item_ID",
+	"Time_Dim_Item_Label_Eng", "Time_Dim_Item_Label_Cym", "Time_Type", "Empty4", "Statistical_Population_ID",
+	"Statistical_Population_Label_Eng", "Statistical_Population_Label_Cym", "CDID", "CDIDDescrip", "Empty5", "Empty6",
+	"Empty7", "Empty8", "Empty9", "Empty10", "Empty11", "Empty12",
+}
+
+// The columns of each v4 dimension group, suffixed with the 1-based number of the group.
+var v4DimensionColumns = []string{
+	"Dim_ID_", "dimension_Label_Eng_", "dimension_Label_Cym_", "Dim_Item_ID_", "dimension_Item_Label_Eng_",
+	"dimension_Item_Label_Cym_", "Is_Total_", "Is_Sub_Total_",
+}
+
+// The positions within a dimension group of the fields every dimension must have.
+var v4RequiredDimensionFields = []int{0, 1, 3, 4}
+
+const (
+	v4ObservationColumn = 0
+	v4DataMarkingColumn = 1
+)
+
+type v4Validator struct {
+	// columns the number of columns in the header, or 0 if the header is not known.
+	columns int
+}
+
+func (v *v4Validator) ValidateHeader(columns []string) []Violation {
+	var violations []Violation
+
+	if len(columns) < len(v4Columns) {
+		violations = append(violations, Violation{
+			Message: fmt.Sprintf("expected at least %d columns but found %d", len(v4Columns), len(columns)),
+		})
+	}
+	if (len(columns)-len(v4Columns))%len(v4DimensionColumns) != 0 {
+		violations = append(violations, Violation{
+			Message: fmt.Sprintf("dimension columns must be in groups of %d", len(v4DimensionColumns)),
+		})
+	}
+
+	for i, column := range columns {
+		if expected := v4ColumnName(i); column != expected {
+			violations = append(violations, Violation{
+				Column:  column,
+				Message: fmt.Sprintf("expected column %d to be %s", i+1, expected),
+			})
+		}
+	}
+
+	v.columns = len(columns)
+	return violations
+}
+
+func (v *v4Validator) ValidateRow(fields []string) []Violation {
+	var violations []Violation
+
+	if v.columns > 0 && len(fields) != v.columns {
+		violations = append(violations, Violation{
+			Message: fmt.Sprintf("expected %d columns but found %d", v.columns, len(fields)),
+		})
+	}
+	if len(fields) <= v4DataMarkingColumn {
+		return violations
+	}
+
+	observation, dataMarking := fields[v4ObservationColumn], fields[v4DataMarkingColumn]
+	if len(observation) == 0 {
+		if len(dataMarking) == 0 {
+			violations = append(violations, Violation{
+				Column:  v4Columns[v4ObservationColumn],
+				Message: "a blank observation must have a data marking",
+			})
+		}
+	} else if _, err := strconv.ParseFloat(observation, 64); err != nil {
+		violations = append(violations, Violation{
+			Column:  v4Columns[v4ObservationColumn],
+			Message: fmt.Sprintf("%q is not a number", observation),
+		})
+	}
+
+	for start := len(v4Columns); start < len(fields); start += len(v4DimensionColumns) {
+		group := fields[start:minInt(start+len(v4DimensionColumns), len(fields))]
+		if isBlank(group) {
+			continue
+		}
+		for _, i := range v4RequiredDimensionFields {
+			if i >= len(group) || len(group[i]) == 0 {
+				violations = append(violations, Violation{
+					Column:  v4ColumnName(start + i),
+					Message: "incomplete dimension",
+				})
+			}
+		}
+	}
+
+	return violations
+}
+
+// v4ColumnName returns the expected name of the 0-based column i of a v4 file.
+func v4ColumnName(i int) string {
+	if i < len(v4Columns) {
+		return v4Columns[i]
+	}
+	i -= len(v4Columns)
+	group := i/len(v4DimensionColumns) + 1
+	return v4DimensionColumns[i%len(v4DimensionColumns)] + strconv.Itoa(group)
+}
+
+func isBlank(fields []string) bool {
+	for _, field := range fields {
+		if len(field) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
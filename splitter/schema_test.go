@@ -0,0 +1,100 @@
+package splitter_test
+
+import (
+	"encoding/csv"
+	"os"
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/config"
+	"github.com/ONSdigital/dp-csv-splitter/splitter"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func readSampleCSV() [][]string {
+	file, err := os.Open("../sample_csv/Open-Data-small.csv")
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		panic(err)
+	}
+	return records
+}
+
+func TestV4Validator(t *testing.T) {
+
+	records := readSampleCSV()
+	header, row := records[0], records[1]
+
+	Convey("Given a v4 validator", t, func() {
+		validator, err := splitter.NewValidator(splitter.SchemaV4)
+		So(err, ShouldBeNil)
+
+		Convey("When the header of the sample file is validated", func() {
+			violations := validator.ValidateHeader(header)
+
+			Convey("Then there are no violations", func() {
+				So(violations, ShouldBeEmpty)
+			})
+
+			Convey("And a row from the sample file is valid", func() {
+				So(validator.ValidateRow(row), ShouldBeEmpty)
+			})
+
+			Convey("And a row with a missing column is invalid", func() {
+				So(validator.ValidateRow(row[:len(row)-1]), ShouldNotBeEmpty)
+			})
+
+			Convey("And a blank observation needs a data marking", func() {
+				blank := append([]string{"", ""}, row[2:]...)
+				So(validator.ValidateRow(blank), ShouldResemble, []splitter.Violation{
+					{Column: "Observation", Message: "a blank observation must have a data marking"},
+				})
+				blank[1] = "x"
+				So(validator.ValidateRow(blank), ShouldBeEmpty)
+			})
+
+			Convey("And a non-numeric observation is invalid", func() {
+				text := append([]string{"many"}, row[1:]...)
+				So(len(validator.ValidateRow(text)), ShouldEqual, 1)
+			})
+
+			Convey("And an incomplete dimension group is invalid", func() {
+				incomplete := append([]string{}, row...)
+				incomplete[38] = ""
+				So(validator.ValidateRow(incomplete), ShouldResemble, []splitter.Violation{
+					{Column: "Dim_Item_ID_1", Message: "incomplete dimension"},
+				})
+			})
+		})
+
+		Convey("When a header with an incomplete dimension group is validated", func() {
+			violations := validator.ValidateHeader(header[:len(header)-1])
+
+			Convey("Then there is a violation", func() {
+				So(violations, ShouldNotBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given an unknown schema", t, func() {
+		_, err := splitter.NewValidator("v3")
+
+		Convey("Then an error is returned", func() {
+			So(err, ShouldEqual, splitter.ErrUnknownSchema)
+		})
+	})
+
+	Convey("Given the schemas the configuration allows", t, func() {
+		Convey("Then each has a validator", func() {
+			for _, schema := range config.Schemas {
+				validator, err := splitter.NewValidator(schema)
+				So(err, ShouldBeNil)
+				So(validator, ShouldNotBeNil)
+			}
+		})
+	})
+}
@@ -0,0 +1,256 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrSheetNotFound is returned when the workbook has no sheet with the requested name or position.
+var ErrSheetNotFound = errors.New("sheet not found in workbook")
+
+// ErrInvalidWorkbook is returned when the file is missing the parts every xlsx workbook has.
+var ErrInvalidWorkbook = errors.New("file is not a valid xlsx workbook")
+
+type workbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// richText a string that is either plain text or a series of formatted runs.
+type richText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt richText) String() string {
+	text := rt.Text
+	for _, run := range rt.Runs {
+		text += run.Text
+	}
+	return text
+}
+
+type cell struct {
+	Ref       string   `xml:"r,attr"`
+	Type      string   `xml:"t,attr"`
+	Value     string   `xml:"v"`
+	InlineStr richText `xml:"is"`
+}
+
+// NewSheetReader returns a reader of the CSV text of a sheet in the xlsx workbook. The sheet is chosen by name, or by
+// its 1-based position in the workbook, and the first sheet is used when sheet is empty. Each row of the sheet becomes
+// one CSV record, with empty cells written as empty fields. Cell values are written as stored in the workbook, so
+// numbers and dates are not formatted. The rows are converted as they are read, so the reader must be closed.
+func NewSheetReader(r io.ReaderAt, size int64, sheet string) (io.ReadCloser, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make(map[string]*zip.File)
+	for _, part := range zipReader.File {
+		parts[part.Name] = part
+	}
+
+	sheetPart, err := findSheet(parts, sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	var sharedStrings []string
+	if sharedStringsPart, ok := parts["xl/sharedStrings.xml"]; ok {
+		if sharedStrings, err = readSharedStrings(sharedStringsPart); err != nil {
+			return nil, err
+		}
+	}
+
+	sheetXML, err := sheetPart.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		err := writeSheet(pipeWriter, sheetXML, sharedStrings)
+		sheetXML.Close()
+		pipeWriter.CloseWithError(err)
+	}()
+	return pipeReader, nil
+}
+
+func findSheet(parts map[string]*zip.File, sheet string) (*zip.File, error) {
+	var book workbook
+	if err := decodePart(parts, "xl/workbook.xml", &book); err != nil {
+		return nil, err
+	}
+	var rels relationships
+	if err := decodePart(parts, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+
+	relID := ""
+	for i, s := range book.Sheets {
+		if s.Name == sheet || (len(sheet) == 0 && i == 0) {
+			relID = s.ID
+			break
+		}
+	}
+	if len(relID) == 0 {
+		if position, err := strconv.Atoi(sheet); err == nil && position > 0 && position <= len(book.Sheets) {
+			relID = book.Sheets[position-1].ID
+		}
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID != relID || len(relID) == 0 {
+			continue
+		}
+		// Targets are relative to the xl directory, or absolute from the root of the package.
+		name := strings.TrimPrefix(rel.Target, "/")
+		if !strings.HasPrefix(rel.Target, "/") {
+			name = path.Join("xl", rel.Target)
+		}
+		if part, ok := parts[name]; ok {
+			return part, nil
+		}
+	}
+	return nil, ErrSheetNotFound
+}
+
+func decodePart(parts map[string]*zip.File, name string, v interface{}) error {
+	part, ok := parts[name]
+	if !ok {
+		return ErrInvalidWorkbook
+	}
+	r, err := part.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xml.NewDecoder(r).Decode(v)
+}
+
+func readSharedStrings(part *zip.File) ([]string, error) {
+	r, err := part.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var values []string
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "si" {
+			var si richText
+			if err := decoder.DecodeElement(&si, &start); err != nil {
+				return nil, err
+			}
+			values = append(values, si.String())
+		}
+	}
+}
+
+// writeSheet streams the rows of the sheet XML to w as CSV records.
+func writeSheet(w io.Writer, sheetXML io.Reader, sharedStrings []string) error {
+	csvWriter := csv.NewWriter(w)
+	decoder := xml.NewDecoder(sheetXML)
+	var record []string
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+		if err != nil {
+			return err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "row":
+				record = record[:0]
+			case "c":
+				var c cell
+				if err := decoder.DecodeElement(&c, &element); err != nil {
+					return err
+				}
+				// Cells without a value are omitted from the XML, so pad up to this cell's column.
+				if column := columnIndex(c.Ref); column >= 0 {
+					for len(record) < column {
+						record = append(record, "")
+					}
+				}
+				record = append(record, cellValue(c, sharedStrings))
+			}
+		case xml.EndElement:
+			if element.Name.Local == "row" {
+				if err := csvWriter.Write(record); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func cellValue(c cell, sharedStrings []string) string {
+	switch c.Type {
+	case "s":
+		index, err := strconv.Atoi(c.Value)
+		if err != nil || index < 0 || index >= len(sharedStrings) {
+			return ""
+		}
+		return sharedStrings[index]
+	case "inlineStr":
+		return c.InlineStr.String()
+	case "b":
+		if c.Value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		return c.Value
+	}
+}
+
+// columnIndex returns the 0-based column of a cell reference such as "AB12", or -1 if there is no reference.
+func columnIndex(ref string) int {
+	column := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 {
+		return -1
+	}
+	return column - 1
+}
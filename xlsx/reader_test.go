@@ -0,0 +1,98 @@
+package xlsx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ONSdigital/dp-csv-splitter/xlsx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var workbookParts = map[string]string{
+	"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="Data" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`,
+	"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+</Relationships>`,
+	"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Observation</t></si><si><t>Geographic_Area</t></si><si><r><t>All categories: </t></r><r><t>Sex</t></r></si>
+</sst>`,
+	"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>Notes sheet</t></is></c></row>
+</sheetData></worksheet>`,
+	"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2"><v>153223</v></c><c r="C2" t="str"><v>K04000001</v></c><c r="D2" t="s"><v>2</v></c></row>
+<row r="3"><c r="B3" t="inlineStr"><is><t>x, "quoted"</t></is></c></row>
+</sheetData></worksheet>`,
+}
+
+func newWorkbook() *bytes.Reader {
+	var b bytes.Buffer
+	writer := zip.NewWriter(&b)
+	for name, content := range workbookParts {
+		w, _ := writer.Create(name)
+		w.Write([]byte(content))
+	}
+	writer.Close()
+	return bytes.NewReader(b.Bytes())
+}
+
+func TestNewSheetReader(t *testing.T) {
+
+	Convey("Given a workbook with two sheets", t, func() {
+		workbook := newWorkbook()
+
+		Convey("When the sheet is chosen by name", func() {
+			sheet, err := xlsx.NewSheetReader(workbook, workbook.Size(), "Data")
+			So(err, ShouldBeNil)
+			defer sheet.Close()
+			csv, _ := ioutil.ReadAll(sheet)
+
+			Convey("Then each row is converted to a CSV record", func() {
+				So(string(csv), ShouldEqual, "Observation,,Geographic_Area\n"+
+					"153223,,K04000001,All categories: Sex\n"+
+					",\"x, \"\"quoted\"\"\"\n")
+			})
+		})
+
+		Convey("When the sheet is chosen by position", func() {
+			sheet, err := xlsx.NewSheetReader(workbook, workbook.Size(), "1")
+			So(err, ShouldBeNil)
+			defer sheet.Close()
+			csv, _ := ioutil.ReadAll(sheet)
+
+			Convey("Then that sheet is converted", func() {
+				So(string(csv), ShouldEqual, "Notes sheet\n")
+			})
+		})
+
+		Convey("When no sheet is chosen", func() {
+			sheet, err := xlsx.NewSheetReader(workbook, workbook.Size(), "")
+			So(err, ShouldBeNil)
+			defer sheet.Close()
+			csv, _ := ioutil.ReadAll(sheet)
+
+			Convey("Then the first sheet is converted", func() {
+				So(string(csv), ShouldEqual, "Notes sheet\n")
+			})
+		})
+
+		Convey("When the sheet does not exist", func() {
+			_, err := xlsx.NewSheetReader(workbook, workbook.Size(), "Missing")
+
+			Convey("Then a sheet not found error is returned", func() {
+				So(err, ShouldEqual, xlsx.ErrSheetNotFound)
+			})
+		})
+	})
+}